@@ -0,0 +1,213 @@
+// Command tracker runs the Target Tracker state machine locally.  It reads the same products JSON as the state
+// machine, checks each product, saves the stats to a directory and formats the alerts, all in-process, and prints the
+// results and messages.  Alerts are printed rather than published to SNS.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/akijowski/target-tracker/historicalStats/stats"
+	"github.com/akijowski/target-tracker/messageFormatter/formatter"
+	"github.com/akijowski/target-tracker/productChecker/checker"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const defaultAPI = "https://redsky.target.com"
+
+// options are the command-line flags.
+type options struct {
+	Products    string
+	StatsDir    string
+	API         string
+	Zip         string
+	Radius      int
+	StoreID     string
+	ShippingZip string
+	State       string
+	DryRun      bool
+	JSON        bool
+	Verbose     bool
+}
+
+func parseFlags(args []string, stderr io.Writer) (options, error) {
+	o := options{}
+	fs := flag.NewFlagSet("tracker", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tracker [flags]\n\nRuns the Target Tracker state machine locally, and prints the results and messages.\n\nFlags:")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&o.Products, "products", "-", "state machine input `file` with the products to check, or - for stdin")
+	fs.StringVar(&o.StatsDir, "stats-dir", "stats", "`directory` the historical stats are kept in")
+	fs.StringVar(&o.API, "api", envOrDefault(checker.URIEnvKey, defaultAPI), "Target API `URI`")
+	fs.StringVar(&o.Zip, "zip", "", "ZIP code to find stores for pickup near (default 80134)")
+	fs.IntVar(&o.Radius, "radius", 0, "`miles` from the ZIP code to find stores within (default 50)")
+	fs.StringVar(&o.StoreID, "store", "", "`ID` of the store to check shipping from (default 1976)")
+	fs.StringVar(&o.ShippingZip, "shipping-zip", "", "ZIP code to check shipping to (default 80016)")
+	fs.StringVar(&o.State, "state", "", "state to check shipping to (default CO)")
+	fs.BoolVar(&o.DryRun, "dry-run", false, "keep the stats in memory, and do not notify webhooks, push subscribers or save results to DynamoDB")
+	fs.BoolVar(&o.JSON, "json", false, "print the state machine output as JSON")
+	fs.BoolVar(&o.Verbose, "v", false, "log what the functions do to stderr")
+	if err := fs.Parse(args); err != nil {
+		return o, err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return o, fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+	if o.Radius < 0 {
+		return o, fmt.Errorf("radius must be positive, got %d", o.Radius)
+	}
+	return o, nil
+}
+
+// configs are the configurations of the functions for the options.  Anything the options do not set is read from
+// the environment, as the functions do in Lambda.
+type configs struct {
+	Checker   checker.Config
+	Stats     stats.Config
+	Formatter formatter.Config
+}
+
+func loadConfigs(o options, logger *log.Logger) (configs, error) {
+	c := configs{}
+	var err error
+	if c.Checker, err = checker.LoadConfig(); err != nil {
+		return c, fmt.Errorf("product checker: %w", err)
+	}
+	c.Checker.API = o.API
+	loc := &c.Checker.Location
+	for _, setting := range []struct {
+		flag  string
+		field *string
+	}{{o.Zip, &loc.Zip}, {o.StoreID, &loc.StoreID}, {o.ShippingZip, &loc.ShippingZip}, {o.State, &loc.State}} {
+		if setting.flag != "" {
+			*setting.field = setting.flag
+		}
+	}
+	if o.Radius > 0 {
+		loc.Radius = o.Radius
+	}
+	if c.Stats, err = stats.LoadConfig(); err != nil {
+		return c, fmt.Errorf("historical stats: %w", err)
+	}
+	c.Stats.Store = stats.DirStatsStore(o.StatsDir)
+	c.Formatter = formatter.LoadConfig(logger)
+	c.Formatter.Stats, c.Formatter.StatsBucket = formatter.DirStatsObjects(o.StatsDir), o.StatsDir
+	if o.DryRun {
+		// the formatter reads the stats saved by this run from the same store
+		store := stats.NewMemoryStatsStore(nil)
+		c.Stats.Store = store
+		c.Formatter.Stats, c.Formatter.StatsBucket = storeObjects{store}, "memory"
+		c.Checker.ResultsTable = ""
+		c.Formatter.Webhooks = nil
+		c.Formatter.PushSubscriptions = nil
+	}
+	return c, nil
+}
+
+// configure sets up the functions as the Lambda runtime would.
+func configure(ctx context.Context, o options, logger *log.Logger) (pipeline, error) {
+	c, err := loadConfigs(o, logger)
+	if err != nil {
+		return pipeline{}, err
+	}
+	check, err := checker.New(ctx, logger, c.Checker)
+	if err != nil {
+		return pipeline{}, fmt.Errorf("product checker: %w", err)
+	}
+	save, err := stats.New(logger, c.Stats)
+	if err != nil {
+		return pipeline{}, fmt.Errorf("historical stats: %w", err)
+	}
+	format := formatter.New(logger, c.Formatter)
+	return pipeline{Check: check.Handle, Save: save.Handle, Format: format.Handle}, nil
+}
+
+// storeObjects reads the objects in a stats store the way the message formatter reads them from S3.  The bucket of
+// each request is ignored.
+type storeObjects struct {
+	store stats.StatsStore
+}
+
+func (s storeObjects) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	b, _, err := s.store.Get(ctx, aws.ToString(params.Key))
+	if err != nil {
+		return nil, err
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(b))}, nil
+}
+
+func readInput(o options, stdin io.Reader) (Input, error) {
+	r := stdin
+	if o.Products != "-" {
+		f, err := os.Open(o.Products)
+		if err != nil {
+			return Input{}, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var input Input
+	if err := json.NewDecoder(r).Decode(&input); err != nil {
+		return Input{}, fmt.Errorf("reading products: %w", err)
+	}
+	return input, nil
+}
+
+func main() {
+	o, err := parseFlags(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tracker:", err)
+		os.Exit(2)
+	}
+	logger := log.New(io.Discard, "", 0)
+	if o.Verbose {
+		logger = log.New(os.Stderr, "tracker ", log.Lshortfile|log.Lmsgprefix)
+	}
+	ctx := context.Background()
+	input, err := readInput(o, os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tracker:", err)
+		os.Exit(1)
+	}
+	p, err := configure(ctx, o, logger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tracker:", err)
+		os.Exit(1)
+	}
+	out, err := run(ctx, p, input)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tracker:", err)
+		os.Exit(1)
+	}
+	if o.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		if err := enc.Encode(out); err != nil {
+			fmt.Fprintln(os.Stderr, "tracker:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	printOutput(os.Stdout, out)
+}
+
+func envOrDefault(env, def string) string {
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/akijowski/target-tracker/productChecker/checker"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestParseFlags(t *testing.T) {
+	cases := map[string]struct {
+		args        []string
+		expected    options
+		expectedErr bool
+	}{
+		"Defaults": {
+			expected: options{Products: "-", StatsDir: "stats", API: defaultAPI},
+		},
+		"Location overrides": {
+			args: []string{"-zip", "55401", "-radius", "20", "-store", "1375", "-shipping-zip", "55403", "-state", "MN", "-dry-run"},
+			expected: options{
+				Products: "-", StatsDir: "stats", API: defaultAPI,
+				Zip: "55401", Radius: 20, StoreID: "1375", ShippingZip: "55403", State: "MN", DryRun: true,
+			},
+		},
+		"Radius must be positive": {
+			args:        []string{"-radius", "-5"},
+			expectedErr: true,
+		},
+		"Arguments are an error": {
+			args:        []string{"products.json"},
+			expectedErr: true,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("API_URI", "")
+			actual, err := parseFlags(tt.args, io.Discard)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("wanted error %t, got %v", tt.expectedErr, err)
+			}
+			if !tt.expectedErr && actual != tt.expected {
+				t.Errorf("wanted %+v, got %+v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestLoadConfigs(t *testing.T) {
+	denver := checker.Location{Zip: "80134", Radius: 50, StoreID: "1976", ShippingZip: "80016", State: "CO"}
+	cases := map[string]struct {
+		options          options
+		expectedLocation checker.Location
+		expectedStore    string
+		expectedTable    string
+		expectedWebhooks int
+	}{
+		"Stats are saved to the directory": {
+			options:          options{StatsDir: "stats", API: defaultAPI},
+			expectedLocation: denver,
+			expectedStore:    "stats.DirStatsStore",
+			expectedTable:    "results",
+			expectedWebhooks: 1,
+		},
+		"Location overrides": {
+			options:          options{StatsDir: "stats", API: defaultAPI, Zip: "55401", Radius: 20, StoreID: "1375", ShippingZip: "55403", State: "MN"},
+			expectedLocation: checker.Location{Zip: "55401", Radius: 20, StoreID: "1375", ShippingZip: "55403", State: "MN"},
+			expectedStore:    "stats.DirStatsStore",
+			expectedTable:    "results",
+			expectedWebhooks: 1,
+		},
+		"Dry run writes nothing": {
+			options:          options{StatsDir: "stats", API: defaultAPI, DryRun: true},
+			expectedLocation: denver,
+			expectedStore:    "*stats.MemoryStatsStore",
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			for _, env := range []string{"PICKUP_ZIP", "PICKUP_RADIUS", "SHIPPING_STORE_ID", "SHIPPING_ZIP", "SHIPPING_STATE", "STATS_DIR", "PUSH_SUBSCRIPTIONS"} {
+				t.Setenv(env, "")
+			}
+			t.Setenv("RESULTS_TABLE_NAME", "results")
+			t.Setenv("WEBHOOK_SUBSCRIPTIONS", `[{"platform": "slack", "url": "https://hooks.slack.com/services/T0/B0/X", "pickup": true}]`)
+
+			actual, err := loadConfigs(tt.options, log.New(io.Discard, "", 0))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if actual.Checker.API != defaultAPI || actual.Checker.Location != tt.expectedLocation {
+				t.Errorf("wanted %s near %+v, got %s near %+v", defaultAPI, tt.expectedLocation, actual.Checker.API, actual.Checker.Location)
+			}
+			if store := fmt.Sprintf("%T", actual.Stats.Store); store != tt.expectedStore {
+				t.Errorf("wanted %s, got %s", tt.expectedStore, store)
+			}
+			if actual.Checker.ResultsTable != tt.expectedTable || len(actual.Formatter.Webhooks) != tt.expectedWebhooks {
+				t.Errorf("wanted table %q and %d webhooks, got %q and %+v", tt.expectedTable, tt.expectedWebhooks, actual.Checker.ResultsTable, actual.Formatter.Webhooks)
+			}
+		})
+	}
+}
+
+func TestLoadConfigs_StatsAreShared(t *testing.T) {
+	cases := map[string]struct {
+		dryRun bool
+	}{
+		"Directory": {},
+		"Dry run":   {dryRun: true},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			c, err := loadConfigs(options{StatsDir: t.TempDir(), API: defaultAPI, DryRun: tt.dryRun}, log.New(io.Discard, "", 0))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := c.Stats.Store.Put(ctx, schema.SummaryObjectKey, []byte("{}"), ""); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			out, err := c.Formatter.Stats.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(c.Formatter.StatsBucket), Key: aws.String(schema.SummaryObjectKey)})
+			if err != nil {
+				t.Fatalf("the formatter cannot read the saved stats: %s", err)
+			}
+			defer out.Body.Close()
+			if b, _ := io.ReadAll(out.Body); string(b) != "{}" {
+				t.Errorf("wanted the saved summary, got %q", b)
+			}
+		})
+	}
+}
+
+func TestReadInput(t *testing.T) {
+	input := `{"products": [{"name": "formula", "tcin": "123", "desired_quantity": 2}], "alert_on_pickup": true}`
+	file := filepath.Join(t.TempDir(), "products.json")
+	if err := os.WriteFile(file, []byte(input), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cases := map[string]struct {
+		products    string
+		stdin       string
+		expectedErr bool
+	}{
+		"From stdin":   {products: "-", stdin: input},
+		"From a file":  {products: file},
+		"Missing file": {products: filepath.Join(t.TempDir(), "missing.json"), expectedErr: true},
+		"Invalid JSON": {products: "-", stdin: "products", expectedErr: true},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := readInput(options{Products: tt.products}, strings.NewReader(tt.stdin))
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("wanted error %t, got %v", tt.expectedErr, err)
+			}
+			if tt.expectedErr {
+				return
+			}
+			if len(actual.Products) != 1 || actual.Products[0].TCIN != "123" || actual.Products[0].DesiredQuantity != 2 || !actual.AlertOnPickup {
+				t.Errorf("unexpected input: %+v", actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/akijowski/target-tracker/messageFormatter/formatter"
+)
+
+// Input is the input of the state machine: the products to check, and whether to send the alerts.
+type Input struct {
+	Products        []schema.Product `json:"products"`
+	AlertOnPickup   bool             `json:"alert_on_pickup"`
+	AlertOnShipping bool             `json:"alert_on_shipping"`
+}
+
+// Output is the state at the end of the state machine: the input with the result of each product, and the messages.
+type Output struct {
+	Input
+	Message formatter.MessageResult `json:"message"`
+}
+
+// pipeline is the handlers of the functions the state machine calls.
+type pipeline struct {
+	Check  func(ctx context.Context, q schema.ProductQuery) (schema.ProductResult, error)
+	Save   func(ctx context.Context, input schema.ProductsInput) error
+	Format func(ctx context.Context, input schema.ProductsInput) (formatter.MessageResult, error)
+}
+
+// run checks each product, then saves the stats and formats the messages, as the state machine does.  A product that
+// cannot be checked is passed on with the error, like the state machine's catch.  The state machine saves the stats
+// and formats the messages in parallel, but they are run one after the other here so the logs are readable.
+func run(ctx context.Context, p pipeline, input Input) (Output, error) {
+	out := Output{Input: input}
+	out.Products = make([]schema.Product, len(input.Products))
+	for i, product := range input.Products {
+		result, err := p.Check(ctx, product.ProductQuery)
+		if err != nil {
+			product.Error = &schema.CheckError{Error: fmt.Sprintf("%T", err), Cause: err.Error()}
+		}
+		product.Result = result
+		out.Products[i] = product
+	}
+	products := schema.ProductsInput{Products: out.Products}
+	if err := p.Save(ctx, products); err != nil {
+		return out, fmt.Errorf("saving stats: %w", err)
+	}
+	message, err := p.Format(ctx, products)
+	if err != nil {
+		return out, fmt.Errorf("formatting messages: %w", err)
+	}
+	out.Message = message
+	return out, nil
+}
+
+// printOutput writes a line for each product, then the messages the state machine would send.
+func printOutput(w io.Writer, out Output) {
+	for _, p := range out.Products {
+		fmt.Fprintf(w, "%s (%s): %s\n", p.Name, p.TCIN, describe(p))
+	}
+	printMessage(w, "Pickup", out.Message.Pickup, out.AlertOnPickup)
+	printMessage(w, "Shipping", out.Message.Shipping, out.AlertOnShipping)
+}
+
+func describe(p schema.Product) string {
+	if p.Failed() {
+		return "check failed: " + p.Error.Cause
+	}
+	pickup := "out of stock"
+	if n := p.Result.Pickup.TotalStores; n == 1 {
+		pickup = "in stock at 1 store"
+	} else if n > 1 {
+		pickup = fmt.Sprintf("in stock at %d stores", n)
+	}
+	shipping := "no shipping"
+	if p.Result.Shipping.IsAvailable {
+		shipping = fmt.Sprintf("shipping %d", p.Result.Shipping.AvailableToPromise)
+	}
+	return pickup + ", " + shipping
+}
+
+func printMessage(w io.Writer, kind, message string, alert bool) {
+	if message == "" {
+		return
+	}
+	state := "sent"
+	if !alert {
+		state = "not sent, the alert is off"
+	}
+	fmt.Fprintf(w, "\n== %s alert (%s) ==\n%s\n", kind, state, strings.TrimRight(message, "\n"))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/akijowski/target-tracker/messageFormatter/formatter"
+)
+
+func TestRun(t *testing.T) {
+	inStock := schema.ProductResult{
+		Pickup:   schema.PickupResult{TotalStores: 2, Stores: []schema.StoreResult{{StoreID: "1234"}, {StoreID: "5678"}}},
+		Shipping: schema.ShippingResult{IsAvailable: true, AvailableToPromise: 10},
+	}
+	input := Input{
+		Products: []schema.Product{
+			{ProductQuery: schema.ProductQuery{Name: "formula", TCIN: "123"}},
+			{ProductQuery: schema.ProductQuery{Name: "diapers", TCIN: "456"}},
+		},
+		AlertOnPickup: true,
+	}
+	cases := map[string]struct {
+		saveErr     error
+		formatErr   error
+		expected    []schema.Product
+		expectedErr bool
+	}{
+		"Products are checked, saved and formatted": {
+			expected: []schema.Product{
+				{ProductQuery: schema.ProductQuery{Name: "formula", TCIN: "123"}, Result: inStock},
+				{ProductQuery: schema.ProductQuery{Name: "diapers", TCIN: "456"}, Error: &schema.CheckError{Error: "*errors.errorString", Cause: "timed out"}},
+			},
+		},
+		"Failing to save stats is an error": {
+			saveErr:     errors.New("disk full"),
+			expectedErr: true,
+		},
+		"Failing to format messages is an error": {
+			formatErr:   errors.New("bad template"),
+			expectedErr: true,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			var saved, formatted schema.ProductsInput
+			p := pipeline{
+				Check: func(ctx context.Context, q schema.ProductQuery) (schema.ProductResult, error) {
+					if q.TCIN == "456" {
+						return schema.ProductResult{}, errors.New("timed out")
+					}
+					return inStock, nil
+				},
+				Save: func(ctx context.Context, input schema.ProductsInput) error {
+					saved = input
+					return tt.saveErr
+				},
+				Format: func(ctx context.Context, input schema.ProductsInput) (formatter.MessageResult, error) {
+					formatted = input
+					return formatter.MessageResult{Pickup: "Product Alert!"}, tt.formatErr
+				},
+			}
+
+			actual, err := run(context.Background(), p, input)
+
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("wanted error %t, got %v", tt.expectedErr, err)
+			}
+			if tt.expectedErr {
+				return
+			}
+			if !reflect.DeepEqual(tt.expected, actual.Products) {
+				t.Errorf("wanted %+v, got %+v", tt.expected, actual.Products)
+			}
+			if !reflect.DeepEqual(saved.Products, actual.Products) || !reflect.DeepEqual(formatted.Products, actual.Products) {
+				t.Errorf("expected the checked products to be saved and formatted, got %+v and %+v", saved, formatted)
+			}
+			if actual.Message.Pickup != "Product Alert!" || !actual.AlertOnPickup {
+				t.Errorf("unexpected output: %+v", actual)
+			}
+			if input.Products[0].Result.Pickup.TotalStores != 0 {
+				t.Error("expected the input to be left as it was")
+			}
+		})
+	}
+}
+
+func TestPrintOutput(t *testing.T) {
+	out := Output{
+		Input: Input{
+			Products: []schema.Product{
+				{ProductQuery: schema.ProductQuery{Name: "formula", TCIN: "123"}, Result: schema.ProductResult{
+					Pickup: schema.PickupResult{TotalStores: 1}, Shipping: schema.ShippingResult{IsAvailable: true, AvailableToPromise: 4},
+				}},
+				{ProductQuery: schema.ProductQuery{Name: "wipes", TCIN: "789"}, Result: schema.ProductResult{Pickup: schema.PickupResult{TotalStores: 3}}},
+				{ProductQuery: schema.ProductQuery{Name: "diapers", TCIN: "456"}, Error: &schema.CheckError{Cause: "timed out"}},
+			},
+			AlertOnPickup: true,
+		},
+		Message: formatter.MessageResult{Pickup: "Product Alert!\nformula\n\n", Shipping: "Product Alert!\nformula ships\n"},
+	}
+	expected := `formula (123): in stock at 1 store, shipping 4
+wipes (789): in stock at 3 stores, no shipping
+diapers (456): check failed: timed out
+
+== Pickup alert (sent) ==
+Product Alert!
+formula
+
+== Shipping alert (not sent, the alert is off) ==
+Product Alert!
+formula ships
+`
+	var b bytes.Buffer
+
+	printOutput(&b, out)
+
+	if b.String() != expected {
+		t.Errorf("wanted\n%s\ngot\n%s", expected, b.String())
+	}
+}
@@ -2,10 +2,15 @@ module github.com/akijowski/target-tracker/historicalStats
 
 go 1.18
 
-require github.com/aws/aws-lambda-go v1.32.0
+require (
+	github.com/aws/aws-lambda-go v1.32.0
+	github.com/aws/aws-sdk-go-v2 v1.16.5
+	github.com/aws/aws-sdk-go-v2/service/s3 v1.26.11
+	github.com/aws/smithy-go v1.11.3
+	github.com/davecgh/go-spew v1.1.1
+)
 
 require (
-	github.com/aws/aws-sdk-go-v2 v1.16.5 // indirect
 	github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream v1.4.2 // indirect
 	github.com/aws/aws-sdk-go-v2/config v1.15.10 // indirect
 	github.com/aws/aws-sdk-go-v2/credentials v1.12.5 // indirect
@@ -18,10 +23,7 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/internal/checksum v1.1.7 // indirect
 	github.com/aws/aws-sdk-go-v2/service/internal/presigned-url v1.9.6 // indirect
 	github.com/aws/aws-sdk-go-v2/service/internal/s3shared v1.13.6 // indirect
-	github.com/aws/aws-sdk-go-v2/service/s3 v1.26.11 // indirect
 	github.com/aws/aws-sdk-go-v2/service/sso v1.11.8 // indirect
 	github.com/aws/aws-sdk-go-v2/service/sts v1.16.7 // indirect
 	github.com/aws/aws-xray-sdk-go v1.7.0 // indirect
-	github.com/aws/smithy-go v1.11.3 // indirect
-	github.com/davecgh/go-spew v1.1.1 // indirect
 )
@@ -0,0 +1,222 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+const (
+	// dashboardKey is named so the bucket can serve it as the index document of a static website.
+	dashboardKey = "index.html"
+	// sparklineHeight is the height of each sparkline in pixels.  Each is one pixel wide per hour of the summary window.
+	sparklineHeight = 30
+)
+
+const dashboardTpl string = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Target Tracker</title>
+<link rel="alternate" type="application/atom+xml" title="Availability" href="{{ .FeedURL }}">
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { padding: 0.3em 0.8em; text-align: left; border-bottom: 1px solid #ddd; }
+td.number { text-align: right; }
+.in-stock { color: #1a7f37; }
+.out-of-stock { color: #b42318; }
+svg.sparkline { background: #f6f8fa; }
+svg.sparkline polyline { fill: none; stroke: #0969da; stroke-width: 1; }
+</style>
+</head>
+<body>
+<h1>Target Tracker</h1>
+<p>Generated {{ utc .GeneratedAt }}.</p>
+<h2>Current stock</h2>
+<table>
+<tr><th>Product</th><th>TCIN</th><th>Stores</th><th>Shipping</th><th>Last checked</th></tr>
+{{- range .Current }}
+<tr>
+<td>{{ .Name }}</td>
+<td>{{ .TCIN }}</td>
+<td class="number {{ if gt .Result.Pickup.TotalStores 0 }}in-stock{{ else }}out-of-stock{{ end }}">
+{{- .Result.Pickup.TotalStores }}</td>
+<td class="{{ if .Result.Shipping.IsAvailable }}in-stock{{ else }}out-of-stock{{ end }}">
+{{- if .Result.Shipping.IsAvailable }}{{ .Result.Shipping.AvailableToPromise }} available{{ else }}unavailable{{ end -}}
+</td>
+<td>{{ utc .LastChecked }}{{ with .ConsecutiveFailures }}, the last {{ . }} checks failed{{ end }}</td>
+</tr>
+{{- end }}
+</table>
+<h2>Last {{ .Window }}</h2>
+<table>
+<tr><th>Product</th><th>Stores in stock, hourly</th><th>In stock 24h</th><th>In stock 7d</th><th>Restocks</th>
+<th>Last in stock</th><th>Likely restock</th></tr>
+{{- range .Products }}
+<tr>
+<td>{{ .ProductName }}</td>
+<td><svg class="sparkline" width="{{ $.SparklineWidth }}" height="{{ $.SparklineHeight }}"
+viewBox="0 0 {{ $.SparklineWidth }} {{ $.SparklineHeight }}">
+{{- range .Sparkline }}<polyline points="{{ . }}"/>{{ end -}}
+</svg> max {{ .MaxStores }}</td>
+<td class="number">{{ printf "%.0f" .InStockPercent24h }}%</td>
+<td class="number">{{ printf "%.0f" .InStockPercent7d }}%</td>
+<td class="number">{{ .Restocks }}</td>
+<td>{{ utc .LastInStock }}</td>
+<td>{{ with .LikelyRestock }}{{ utc .Start }} ({{ printf "%.0f" (percent .RestockProbability) }}% of {{ .Weeks }} weeks)
+{{- else }}unknown{{ end }}</td>
+</tr>
+{{- end }}
+</table>
+<script type="application/json" id="summary">{{ .Summary }}</script>
+</body>
+</html>
+`
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"utc":     formatUTC,
+	"percent": func(fraction float64) float64 { return fraction * 100 },
+}).Parse(dashboardTpl))
+
+// dashboardData is the input to dashboardTpl.
+type dashboardData struct {
+	GeneratedAt int64
+	FeedURL     string
+	// Window describes how far back the summary goes, e.g. "7 days".
+	Window          string
+	SparklineWidth  int
+	SparklineHeight int
+	// Current is the current state of each product, by name.
+	Current  []ProductState
+	Products []dashboardProduct
+	// Summary is embedded as JSON, for scripts on the page or anyone who saves it.
+	Summary *Summary
+}
+
+// dashboardProduct is the summary of a product with a sparkline of the mean number of stores in stock each hour.
+type dashboardProduct struct {
+	ProductSummary
+	// Sparkline is the points of each line in the chart.  Hours without samples break the line.
+	Sparkline []string
+	MaxStores int
+}
+
+// updateDashboard renders the summary, the hourly rollups in it, and the current state in the index as a static HTML
+// page.  It is run after the summary is saved, and reads it back rather than building its own.
+func (r *run) updateDashboard(ctx context.Context, index *StatsIndex, hourly RollupLevel) error {
+	var summary Summary
+	if _, err := r.readJSON(ctx, schema.SummaryObjectKey, &summary, nil, nil); err != nil {
+		return err
+	}
+	var rollups Rollups
+	_, err := r.readJSON(ctx, hourly.Key, &rollups, rollupUpgrades, tcinsByName(index.Current))
+	if err != nil && !errors.Is(err, errNotFound) {
+		return err
+	}
+	current := make([]ProductState, 0, len(index.Current))
+	for _, state := range index.Current {
+		current = append(current, state)
+	}
+	sort.Slice(current, func(i, j int) bool {
+		if current[i].Name != current[j].Name {
+			return current[i].Name < current[j].Name
+		}
+		return current[i].TCIN < current[j].TCIN
+	})
+	b, err := renderDashboard(&summary, &rollups, current)
+	if err != nil {
+		return err
+	}
+	return r.replaceObject(ctx, dashboardKey, b)
+}
+
+func renderDashboard(summary *Summary, hourly *Rollups, current []ProductState) ([]byte, error) {
+	buckets := make(map[string][]RollupBucket, len(hourly.Products))
+	for _, p := range hourly.Products {
+		buckets[p.Key()] = p.Buckets
+	}
+	windowStart := summary.GeneratedAt - summary.WindowSeconds
+	data := dashboardData{
+		GeneratedAt:     summary.GeneratedAt,
+		FeedURL:         feedKey,
+		Window:          formatWindow(time.Duration(summary.WindowSeconds) * time.Second),
+		SparklineWidth:  int(summary.WindowSeconds / int64(time.Hour.Seconds())),
+		SparklineHeight: sparklineHeight,
+		Current:         current,
+		Products:        []dashboardProduct{},
+		Summary:         summary,
+	}
+	for _, p := range summary.Products {
+		lines, highest := sparkline(buckets[p.Key()], windowStart, summary.GeneratedAt)
+		data.Products = append(data.Products, dashboardProduct{ProductSummary: p, Sparkline: lines, MaxStores: highest})
+	}
+	var buf bytes.Buffer
+	if err := dashboardTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sparkline plots the mean stores in stock of the hourly buckets from start to end, one unit wide per hour, scaled
+// to the largest maximum in that time.  It returns the points of each unbroken line and that maximum.
+func sparkline(buckets []RollupBucket, start, end int64) ([]string, int) {
+	highest := 0
+	for _, b := range buckets {
+		if b.Start >= start && b.Start < end && b.Max > highest {
+			highest = b.Max
+		}
+	}
+	lines := []string{}
+	var points []string
+	lastHour := int64(-2)
+	for _, b := range buckets {
+		if b.Start < start || b.Start >= end {
+			continue
+		}
+		hour := (b.Start - start) / int64(time.Hour.Seconds())
+		if hour != lastHour+1 && len(points) > 0 {
+			lines = append(lines, strings.Join(points, " "))
+			points = nil
+		}
+		y := float64(sparklineHeight)
+		if highest > 0 {
+			y -= b.Mean / float64(highest) * sparklineHeight
+		}
+		// a line needs two points, so each hour is drawn across its width
+		points = append(points, fmt.Sprintf("%d,%.1f", hour, y), fmt.Sprintf("%d,%.1f", hour+1, y))
+		lastHour = hour
+	}
+	if len(points) > 0 {
+		lines = append(lines, strings.Join(points, " "))
+	}
+	return lines, highest
+}
+
+// formatWindow describes a window of time for a heading, in days when it is a whole number of them and in hours
+// otherwise.
+func formatWindow(d time.Duration) string {
+	n, unit := int(d/time.Hour), "hour"
+	if d%(24*time.Hour) == 0 {
+		n, unit = int(d/(24*time.Hour)), "day"
+	}
+	if n == 1 {
+		return unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// formatUTC formats a unix time for the dashboard, or "never" for zero.
+func formatUTC(t int64) string {
+	if t == 0 {
+		return "never"
+	}
+	return time.Unix(t, 0).UTC().Format("Mon Jan 2 15:04 MST")
+}
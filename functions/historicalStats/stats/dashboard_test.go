@@ -0,0 +1,156 @@
+package stats
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/davecgh/go-spew/spew"
+)
+
+func TestSparkline(t *testing.T) {
+	start := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hour int) int64 { return start.Add(time.Duration(hour) * time.Hour).Unix() }
+	cases := map[string]struct {
+		buckets       []RollupBucket
+		expectedLines []string
+		expectedMax   int
+	}{
+		"Hours without samples break the line": {
+			buckets: []RollupBucket{
+				{Start: at(-1), Mean: 10, Max: 10},
+				{Start: at(0), Mean: 0, Max: 0},
+				{Start: at(1), Mean: 1.5, Max: 2},
+				{Start: at(3), Mean: 3, Max: 3},
+				{Start: at(4), Mean: 10, Max: 10},
+			},
+			expectedLines: []string{"0,30.0 1,30.0 1,15.0 2,15.0", "3,0.0 4,0.0"},
+			expectedMax:   3,
+		},
+		"Never in stock is a flat line": {
+			buckets:       []RollupBucket{{Start: at(0)}},
+			expectedLines: []string{"0,30.0 1,30.0"},
+		},
+		"No rollups": {
+			expectedLines: []string{},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			lines, highest := sparkline(tt.buckets, start.Unix(), at(4))
+			if !reflect.DeepEqual(tt.expectedLines, lines) || tt.expectedMax != highest {
+				t.Error(spew.Printf("%v %v\n%v %v", tt.expectedLines, tt.expectedMax, lines, highest))
+			}
+		})
+	}
+}
+
+func TestRenderDashboard(t *testing.T) {
+	now := time.Date(2022, 6, 8, 12, 0, 0, 0, time.UTC)
+	summary := &Summary{
+		GeneratedAt:   now.Unix(),
+		WindowSeconds: int64((7 * 24 * time.Hour).Seconds()),
+		Products: []ProductSummary{{
+			TCIN: "123", ProductName: "formula <special>", InStockPercent24h: 50, Restocks: 2, LastInStock: now.Unix(),
+			LikelyRestock: &ForecastWindow{Start: now.Add(time.Hour).Unix(), RestockProbability: 0.75, Weeks: 4},
+		}, {
+			// products without TCINs are told apart by name
+			ProductName: "wipes",
+		}, {
+			ProductName: "bibs",
+		}},
+	}
+	hourly := &Rollups{Products: []ProductRollup{
+		{TCIN: "123", Buckets: []RollupBucket{{Start: now.Add(-time.Hour).Unix(), Mean: 1, Max: 2}}},
+		{ProductName: "bibs", Buckets: []RollupBucket{{Start: now.Add(-time.Hour).Unix(), Mean: 3, Max: 4}}},
+		{ProductName: "wipes", Buckets: []RollupBucket{{Start: now.Add(-time.Hour).Unix(), Mean: 5, Max: 5}}},
+	}}
+	current := []ProductState{{
+		Name: "formula <special>", TCIN: "123", LastChecked: now.Unix(), ConsecutiveFailures: 2,
+		Result: schema.ProductResult{Pickup: schema.PickupResult{TotalStores: 3}},
+	}}
+
+	b, err := renderDashboard(summary, hourly, current)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	actual := string(b)
+	for _, expected := range []string{
+		`<link rel="alternate" type="application/atom+xml" title="Availability" href="feed.atom">`,
+		`<td>formula &lt;special&gt;</td>`,
+		`<td class="number in-stock">3</td>`,
+		`<td class="out-of-stock">unavailable</td>`,
+		`<td>Wed Jun 8 12:00 UTC, the last 2 checks failed</td>`,
+		`<h2>Last 7 days</h2>`,
+		`<svg class="sparkline" width="168" height="30"` + "\n" + `viewBox="0 0 168 30">`,
+		`viewBox="0 0 168 30"><polyline points="167,15.0 168,15.0"/></svg> max 2`,
+		`viewBox="0 0 168 30"><polyline points="167,0.0 168,0.0"/></svg> max 5`,
+		`viewBox="0 0 168 30"><polyline points="167,7.5 168,7.5"/></svg> max 4`,
+		`<td class="number">50%</td>`,
+		`<td>Wed Jun 8 12:00 UTC</td>`,
+		`<td>Wed Jun 8 13:00 UTC (75% of 4 weeks)</td>`,
+		`<script type="application/json" id="summary">{"generated_at":1654689600,`,
+		`"product_name":"formula \u003cspecial\u003e"`,
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("expected %q in the dashboard:\n%s", expected, actual)
+		}
+	}
+}
+
+func TestUpdateDashboard(t *testing.T) {
+	now := time.Date(2022, 6, 8, 12, 0, 0, 0, time.UTC)
+	cases := map[string]struct {
+		objects     map[string][]byte
+		expectedErr error
+	}{
+		"Dashboard is written from the summary": {
+			objects: map[string][]byte{
+				schema.SummaryObjectKey: []byte(`{"generated_at":1654689600,"window_seconds":604800,"products":[]}`),
+				dashboardKey:            []byte("old"),
+			},
+		},
+		"No summary": {
+			objects:     map[string][]byte{},
+			expectedErr: errNotFound,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := testRun(NewMemoryStatsStore(tt.objects), now).updateDashboard(context.Background(), &StatsIndex{}, rollupLevels[0])
+			if err != tt.expectedErr {
+				t.Fatalf("wanted error %v, got %v", tt.expectedErr, err)
+			}
+			b := string(tt.objects[dashboardKey])
+			if err == nil && !strings.HasPrefix(b, "<!DOCTYPE html>") {
+				t.Errorf("expected the dashboard to be replaced: %q", b)
+			}
+		})
+	}
+}
+
+func TestFormatWindow(t *testing.T) {
+	cases := map[string]struct {
+		window   time.Duration
+		expected string
+	}{
+		"Days":     {window: 14 * 24 * time.Hour, expected: "14 days"},
+		"One day":  {window: 24 * time.Hour, expected: "day"},
+		"Hours":    {window: 36 * time.Hour, expected: "36 hours"},
+		"One hour": {window: time.Hour, expected: "hour"},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			if actual := formatWindow(tt.window); actual != tt.expected {
+				t.Errorf("wanted %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
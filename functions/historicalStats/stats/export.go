@@ -0,0 +1,154 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"os"
+	"strconv"
+)
+
+const (
+	csvExportKeyEnv     = "CSV_EXPORT_KEY"
+	parquetExportKeyEnv = "PARQUET_EXPORT_KEY"
+)
+
+// exportColumns are the columns of both exports, in order.  Columns are only ever added to the end, so readers of
+// older exports keep working.
+var exportColumns = []string{
+	"time", "tcin", "product_name", "store_id", "store_quantity", "count", "units", "shipping_available", "shipping_quantity",
+}
+
+// exportRow is a single row of the exports.  Samples with stores have a row for each store, and samples without any
+// have a single row with an empty StoreID.
+type exportRow struct {
+	Time              int64
+	TCIN              string
+	ProductName       string
+	StoreID           string
+	StoreQuantity     int
+	Count             int
+	Units             int
+	ShippingAvailable bool
+	ShippingQuantity  int
+}
+
+// updateExports writes all the history in the index to the configured export keys.
+func (r *run) updateExports(ctx context.Context, index *StatsIndex) error {
+	if r.csvExportKey == "" && r.parquetExportKey == "" {
+		return nil
+	}
+	history, err := r.getHistoryRange(ctx, index, 0, r.now.Unix())
+	if err != nil {
+		return err
+	}
+	rows := exportRows(history.History)
+	if r.csvExportKey != "" {
+		b, err := encodeCSV(rows)
+		if err != nil {
+			return err
+		}
+		if err := r.replaceObject(ctx, r.csvExportKey, b); err != nil {
+			return err
+		}
+	}
+	if r.parquetExportKey != "" {
+		if err := r.replaceObject(ctx, r.parquetExportKey, encodeParquet(rows)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportRows flattens the history into rows, product by product and in time order within each product.
+func exportRows(history []HistoricalStat) []exportRow {
+	rows := []exportRow{}
+	for _, stat := range history {
+		for _, d := range stat.Data {
+			row := exportRow{
+				Time:              d.Time,
+				TCIN:              stat.TCIN,
+				ProductName:       stat.ProductName,
+				Count:             d.Count,
+				Units:             d.Units,
+				ShippingAvailable: d.ShippingAvailable,
+				ShippingQuantity:  d.ShippingQuantity,
+			}
+			if len(d.Stores) == 0 {
+				rows = append(rows, row)
+				continue
+			}
+			for _, s := range d.Stores {
+				row.StoreID = s.StoreID
+				row.StoreQuantity = s.Quantity
+				rows = append(rows, row)
+			}
+		}
+	}
+	return rows
+}
+
+func encodeCSV(rows []exportRow) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(exportColumns); err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		record := []string{
+			strconv.FormatInt(r.Time, 10),
+			r.TCIN,
+			r.ProductName,
+			r.StoreID,
+			strconv.Itoa(r.StoreQuantity),
+			strconv.Itoa(r.Count),
+			strconv.Itoa(r.Units),
+			strconv.FormatBool(r.ShippingAvailable),
+			strconv.Itoa(r.ShippingQuantity),
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func encodeParquet(rows []exportRow) []byte {
+	times := make([]int64, len(rows))
+	tcins := make([]string, len(rows))
+	names := make([]string, len(rows))
+	storeIDs := make([]string, len(rows))
+	storeQuantities := make([]int, len(rows))
+	counts := make([]int, len(rows))
+	units := make([]int, len(rows))
+	shipping := make([]bool, len(rows))
+	shippingQuantities := make([]int, len(rows))
+	for i, r := range rows {
+		times[i] = r.Time
+		tcins[i] = r.TCIN
+		names[i] = r.ProductName
+		storeIDs[i] = r.StoreID
+		storeQuantities[i] = r.StoreQuantity
+		counts[i] = r.Count
+		units[i] = r.Units
+		shipping[i] = r.ShippingAvailable
+		shippingQuantities[i] = r.ShippingQuantity
+	}
+	return writeParquet([]parquetColumn{
+		int64Column(exportColumns[0], times),
+		stringColumn(exportColumns[1], tcins),
+		stringColumn(exportColumns[2], names),
+		stringColumn(exportColumns[3], storeIDs),
+		int32Column(exportColumns[4], storeQuantities),
+		int32Column(exportColumns[5], counts),
+		int32Column(exportColumns[6], units),
+		boolColumn(exportColumns[7], shipping),
+		int32Column(exportColumns[8], shippingQuantities),
+	}, len(rows))
+}
+
+// configureExports reads the keys the exports are written to.
+func configureExports() (string, string) {
+	return os.Getenv(csvExportKeyEnv), os.Getenv(parquetExportKeyEnv)
+}
@@ -0,0 +1,122 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/davecgh/go-spew/spew"
+)
+
+func TestExportRows(t *testing.T) {
+	cases := map[string]struct {
+		history  []HistoricalStat
+		expected []exportRow
+	}{
+		"A row per store": {
+			history: []HistoricalStat{{TCIN: "123", ProductName: "formula", Data: []HistoricalData{
+				{Time: 100, Count: 2, Units: 4, ShippingAvailable: true, ShippingQuantity: 10, Stores: schema.StoreSamples{
+					{StoreID: "1234", Quantity: 3}, {StoreID: "5678", Quantity: 1},
+				}},
+			}}},
+			expected: []exportRow{
+				{Time: 100, TCIN: "123", ProductName: "formula", StoreID: "1234", StoreQuantity: 3, Count: 2, Units: 4, ShippingAvailable: true, ShippingQuantity: 10},
+				{Time: 100, TCIN: "123", ProductName: "formula", StoreID: "5678", StoreQuantity: 1, Count: 2, Units: 4, ShippingAvailable: true, ShippingQuantity: 10},
+			},
+		},
+		"A single row without stores": {
+			history: []HistoricalStat{
+				{TCIN: "123", ProductName: "formula", Data: []HistoricalData{{Time: 100}, {Time: 200}}},
+				{TCIN: "456", ProductName: "other", Data: []HistoricalData{{Time: 100}}},
+			},
+			expected: []exportRow{
+				{Time: 100, TCIN: "123", ProductName: "formula"},
+				{Time: 200, TCIN: "123", ProductName: "formula"},
+				{Time: 100, TCIN: "456", ProductName: "other"},
+			},
+		},
+		"No history": {
+			expected: []exportRow{},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual := exportRows(tt.history)
+			if !reflect.DeepEqual(tt.expected, actual) {
+				t.Error(spew.Printf("%v\n%v", tt.expected, actual))
+			}
+		})
+	}
+}
+
+func TestEncodeCSV(t *testing.T) {
+	rows := []exportRow{
+		{Time: 100, TCIN: "123", ProductName: `formula, "special"`, StoreID: "1234", StoreQuantity: 3, Count: 2, Units: 4, ShippingAvailable: true, ShippingQuantity: 10},
+		{Time: 200, TCIN: "456", ProductName: "other"},
+	}
+	expected := "time,tcin,product_name,store_id,store_quantity,count,units,shipping_available,shipping_quantity\n" +
+		"100,123,\"formula, \"\"special\"\"\",1234,3,2,4,true,10\n" +
+		"200,456,other,,0,0,0,false,0\n"
+
+	actual, err := encodeCSV(rows)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(actual) != expected {
+		t.Errorf("wanted %q, got %q", expected, actual)
+	}
+}
+
+func TestUpdateExports(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	history := mustMarshal(t, HistoricalStats{History: []HistoricalStat{
+		{TCIN: "123", ProductName: "formula", Data: []HistoricalData{{Time: now.Unix(), Count: 1}}},
+	}})
+	index := &StatsIndex{Partitions: []PartitionRef{
+		{Key: "history/2022-06-01.json", Start: now.Unix(), End: now.Unix()},
+	}}
+	cases := map[string]struct {
+		csvKey, parquetKey string
+		expected           []string
+	}{
+		"Both exports": {
+			csvKey:     "exports/history.csv",
+			parquetKey: "exports/history.parquet",
+			expected:   []string{"exports/history.csv", "exports/history.parquet"},
+		},
+		"Only CSV": {
+			csvKey:   "exports/history.csv",
+			expected: []string{"exports/history.csv"},
+		},
+		"Exports turned off": {},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			objects := map[string][]byte{"history/2022-06-01.json": history}
+			r := testRun(NewMemoryStatsStore(objects), now)
+			r.csvExportKey, r.parquetExportKey = tt.csvKey, tt.parquetKey
+
+			if err := r.updateExports(context.Background(), index); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			for _, key := range tt.expected {
+				if len(objects[key]) == 0 {
+					t.Errorf("expected an export at %s", key)
+				}
+			}
+			if len(objects) != len(tt.expected)+1 {
+				t.Errorf("expected %d exports, got %d objects", len(tt.expected), len(objects))
+			}
+			if b, ok := objects["exports/history.csv"]; ok && !bytes.Contains(b, []byte("\n1654084800,123,formula,,0,1,0,false,0\n")) {
+				t.Errorf("expected the sample in the CSV export: %q", b)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package stats
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+)
+
+const (
+	feedKey = "feed.atom"
+	// feedID identifies the feed.  Like the entry IDs it never changes, so readers keep their place across runs.
+	feedID = "urn:target-tracker:feed"
+	// maxFeedEntries is how many of the most recent events are in the feed.
+	maxFeedEntries = 100
+	atomNamespace  = "http://www.w3.org/2005/Atom"
+)
+
+// Kinds of availability events.  They are part of the entry IDs, so must not change.
+const (
+	inStockEvent  = "in-stock"
+	shippingEvent = "shipping"
+)
+
+// availabilityEvent is a product becoming available, either at stores or for shipping.
+type availabilityEvent struct {
+	Time        int64
+	Kind        string
+	TCIN        string
+	ProductName string
+	// Quantity is the number of stores for in-stock events and the quantity available for shipping events.
+	Quantity int
+}
+
+// Key is the Key of the product's history, so products without TCINs are told apart by name.
+func (e availabilityEvent) Key() string {
+	return HistoricalStat{TCIN: e.TCIN, ProductName: e.ProductName}.Key()
+}
+
+// ID is the Atom entry ID of the event.  It is made only from the sample the event was found at, so the same event
+// has the same ID every time the feed is generated.  Product names are escaped to keep the ID a valid URN.
+func (e availabilityEvent) ID() string {
+	return fmt.Sprintf("urn:target-tracker:%s:%s:%d", url.PathEscape(e.Key()), e.Kind, e.Time)
+}
+
+func (e availabilityEvent) Title() string {
+	if e.Kind == shippingEvent {
+		return fmt.Sprintf("%s can be shipped (%d available)", e.ProductName, e.Quantity)
+	}
+	return fmt.Sprintf("%s is in stock at %d stores", e.ProductName, e.Quantity)
+}
+
+// atomFeed is an Atom feed (RFC 4287) with only the elements the availability feed uses.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID      string    `xml:"id"`
+	Title   string    `xml:"title"`
+	Updated string    `xml:"updated"`
+	Link    *atomLink `xml:"link,omitempty"`
+	Summary string    `xml:"summary"`
+}
+
+// updateFeed writes an Atom feed of the availability events in the raw history kept, which goes back window.
+func (r *run) updateFeed(ctx context.Context, index *StatsIndex, window time.Duration) error {
+	history, err := r.getHistoryRange(ctx, index, r.now.Add(-window).Unix(), r.now.Unix())
+	if err != nil {
+		return err
+	}
+	urls := make(map[string]string, len(index.Current))
+	for key, p := range index.Current {
+		urls[key] = p.ProductURL
+	}
+	b, err := encodeFeed(availabilityEvents(history.History), urls, r.now)
+	if err != nil {
+		return err
+	}
+	return r.replaceObject(ctx, feedKey, b)
+}
+
+// availabilityEvents finds when each product came in stock or became available for shipping, newest first.  As with
+// restocks in the summary, an event needs a sample before it where the product was unavailable.
+func availabilityEvents(history []HistoricalStat) []availabilityEvent {
+	events := []availabilityEvent{}
+	for _, stat := range history {
+		for i := 1; i < len(stat.Data); i++ {
+			prev, d := stat.Data[i-1], stat.Data[i]
+			event := availabilityEvent{Time: d.Time, TCIN: stat.TCIN, ProductName: stat.ProductName}
+			if prev.Count == 0 && d.Count > 0 {
+				event.Kind, event.Quantity = inStockEvent, d.Count
+				events = append(events, event)
+			}
+			if !prev.ShippingAvailable && d.ShippingAvailable {
+				event.Kind, event.Quantity = shippingEvent, d.ShippingQuantity
+				events = append(events, event)
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time > events[j].Time })
+	if len(events) > maxFeedEntries {
+		events = events[:maxFeedEntries]
+	}
+	return events
+}
+
+// encodeFeed writes the events as an Atom feed, linking each to the product's page in urls, by product key.  The feed
+// is updated as of the newest event, or now when there are none.
+func encodeFeed(events []availabilityEvent, urls map[string]string, now time.Time) ([]byte, error) {
+	updated := now.Unix()
+	if len(events) > 0 {
+		updated = events[0].Time
+	}
+	feed := atomFeed{
+		Xmlns:   atomNamespace,
+		ID:      feedID,
+		Title:   "Target Tracker availability",
+		Updated: atomTime(updated),
+		Author:  atomAuthor{Name: "Target Tracker"},
+		// relative to the feed, which is next to the dashboard
+		Link:    atomLink{Href: dashboardKey},
+		Entries: []atomEntry{},
+	}
+	for _, e := range events {
+		entry := atomEntry{
+			ID: e.ID(), Title: e.Title(), Updated: atomTime(e.Time), Summary: e.Title() + " as of " + formatUTC(e.Time) + ".",
+		}
+		if href := urls[e.Key()]; href != "" {
+			entry.Link = &atomLink{Href: href}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	b, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+func atomTime(t int64) string {
+	return time.Unix(t, 0).UTC().Format(time.RFC3339)
+}
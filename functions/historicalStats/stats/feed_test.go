@@ -0,0 +1,142 @@
+package stats
+
+import (
+	"context"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+func TestAvailabilityEvents(t *testing.T) {
+	cases := map[string]struct {
+		history  []HistoricalStat
+		expected []availabilityEvent
+	}{
+		"Coming in stock and shipping are events, newest first": {
+			history: []HistoricalStat{
+				{TCIN: "123", ProductName: "formula", Data: []HistoricalData{
+					{Time: 100, Count: 1},
+					{Time: 200},
+					{Time: 300, Count: 3, ShippingAvailable: true, ShippingQuantity: 10},
+					{Time: 400, Count: 2, ShippingAvailable: true, ShippingQuantity: 5},
+				}},
+				{TCIN: "456", ProductName: "other", Data: []HistoricalData{
+					{Time: 100},
+					{Time: 250, Count: 1},
+				}},
+			},
+			expected: []availabilityEvent{
+				{Time: 300, Kind: inStockEvent, TCIN: "123", ProductName: "formula", Quantity: 3},
+				{Time: 300, Kind: shippingEvent, TCIN: "123", ProductName: "formula", Quantity: 10},
+				{Time: 250, Kind: inStockEvent, TCIN: "456", ProductName: "other", Quantity: 1},
+			},
+		},
+		"The first sample is not an event": {
+			history: []HistoricalStat{
+				{TCIN: "123", ProductName: "formula", Data: []HistoricalData{{Time: 100, Count: 1, ShippingAvailable: true}}},
+			},
+			expected: []availabilityEvent{},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual := availabilityEvents(tt.history)
+			if !reflect.DeepEqual(tt.expected, actual) {
+				t.Error(spew.Printf("%v\n%v", tt.expected, actual))
+			}
+		})
+	}
+}
+
+func TestAvailabilityEvents_Limit(t *testing.T) {
+	data := []HistoricalData{}
+	for i := 0; i < maxFeedEntries+10; i++ {
+		data = append(data, HistoricalData{Time: int64(2 * i)}, HistoricalData{Time: int64(2*i + 1), Count: 1})
+	}
+
+	actual := availabilityEvents([]HistoricalStat{{TCIN: "123", Data: data}})
+
+	if len(actual) != maxFeedEntries || actual[0].Time != data[len(data)-1].Time {
+		t.Errorf("expected the newest %d events, got %d starting at %d", maxFeedEntries, len(actual), actual[0].Time)
+	}
+}
+
+func TestEncodeFeed(t *testing.T) {
+	now := time.Date(2022, 6, 8, 12, 0, 0, 0, time.UTC)
+	events := []availabilityEvent{
+		{Time: now.Add(-time.Hour).Unix(), Kind: inStockEvent, TCIN: "123", ProductName: "formula & more", Quantity: 3},
+		{Time: now.Add(-2 * time.Hour).Unix(), Kind: shippingEvent, TCIN: "456", ProductName: "other", Quantity: 10},
+		{Time: now.Add(-3 * time.Hour).Unix(), Kind: inStockEvent, ProductName: "baby wipes", Quantity: 1},
+	}
+	urls := map[string]string{"123": "https://www.target.com/p/-/A-123", "baby wipes": "https://www.target.com/p/-/A-789"}
+
+	b, err := encodeFeed(events, urls, now)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var feed atomFeed
+	if err := xml.Unmarshal(b, &feed); err != nil {
+		t.Fatalf("unable to read the feed back: %s\n%s", err, b)
+	}
+	if feed.XMLName.Space != atomNamespace || feed.ID != feedID || feed.Updated != "2022-06-08T11:00:00Z" {
+		t.Error(spew.Sprintf("unexpected feed: %v", feed))
+	}
+	expected := []atomEntry{
+		{
+			ID:      "urn:target-tracker:123:in-stock:1654686000",
+			Title:   "formula & more is in stock at 3 stores",
+			Updated: "2022-06-08T11:00:00Z",
+			Link:    &atomLink{Href: "https://www.target.com/p/-/A-123"},
+			Summary: "formula & more is in stock at 3 stores as of Wed Jun 8 11:00 UTC.",
+		},
+		{
+			ID:      "urn:target-tracker:456:shipping:1654682400",
+			Title:   "other can be shipped (10 available)",
+			Updated: "2022-06-08T10:00:00Z",
+			Summary: "other can be shipped (10 available) as of Wed Jun 8 10:00 UTC.",
+		},
+		{
+			ID:      "urn:target-tracker:baby%20wipes:in-stock:1654678800",
+			Title:   "baby wipes is in stock at 1 stores",
+			Updated: "2022-06-08T09:00:00Z",
+			Link:    &atomLink{Href: "https://www.target.com/p/-/A-789"},
+			Summary: "baby wipes is in stock at 1 stores as of Wed Jun 8 09:00 UTC.",
+		},
+	}
+	if !reflect.DeepEqual(expected, feed.Entries) {
+		t.Error(spew.Printf("%v\n%v", expected, feed.Entries))
+	}
+}
+
+func TestUpdateFeed(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	objects := map[string][]byte{
+		"history/2022-06-01.json": mustMarshal(t, HistoricalStats{History: []HistoricalStat{
+			{TCIN: "123", ProductName: "formula", Data: []HistoricalData{{Time: now.Add(-time.Hour).Unix()}, {Time: now.Unix(), Count: 3}}},
+		}}),
+	}
+	index := &StatsIndex{Partitions: []PartitionRef{
+		{Key: "history/2022-06-01.json", Start: now.Add(-time.Hour).Unix(), End: now.Unix()},
+	}}
+	r := testRun(NewMemoryStatsStore(objects), now)
+
+	// the same history gives the same feed
+	for run := 0; run < 2; run++ {
+		previous := objects[feedKey]
+		if err := r.updateFeed(context.Background(), index, 7*24*time.Hour); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if run > 0 && string(previous) != string(objects[feedKey]) {
+			t.Errorf("expected the feed to be stable:\n%s\n%s", previous, objects[feedKey])
+		}
+	}
+	if !strings.Contains(string(objects[feedKey]), "<id>urn:target-tracker:123:in-stock:1654084800</id>") {
+		t.Errorf("expected an entry for the restock:\n%s", objects[feedKey])
+	}
+}
@@ -0,0 +1,165 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+const (
+	s3NoSuchKeyErr = "NoSuchKey"
+	// S3 returns either of these when a conditional write fails
+	s3PreconditionFailedErr  = "PreconditionFailed"
+	s3ConditionalConflictErr = "ConditionalRequestConflict"
+	maxWriteAttempts         = 3
+	quarantinePrefix         = "quarantine/"
+	bucketNameEnv            = "STATS_BUCKET_NAME"
+	retentionEnv             = "STATS_RETENTION"
+	// 1 week
+	defaultRetention = 7 * 24 * time.Hour
+)
+
+// Handler saves the results of each run to its store, and rebuilds the documents made from them.  Create it with New.
+type Handler struct {
+	logger *log.Logger
+	store  StatsStore
+	// retention is how long raw samples are kept.
+	retention time.Duration
+	rollups   []RollupLevel
+	// csvExportKey and parquetExportKey are where the exports are written.  An empty key turns that export off.
+	csvExportKey     string
+	parquetExportKey string
+}
+
+// run is a single invocation of a Handler, which samples the products at now.
+type run struct {
+	*Handler
+	now time.Time
+}
+
+// New sets up a Handler with cfg, which logs to l.
+func New(l *log.Logger, cfg Config) (*Handler, error) {
+	store := cfg.Store
+	if store == nil {
+		var err error
+		if store, err = configureStore(l, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return &Handler{
+		logger:           l,
+		store:            store,
+		retention:        cfg.Retention,
+		rollups:          cfg.Rollups,
+		csvExportKey:     cfg.CSVExportKey,
+		parquetExportKey: cfg.ParquetExportKey,
+	}, nil
+}
+
+// Handle saves the results of a run to the stats store, and rebuilds the documents made from them.
+func (h *Handler) Handle(ctx context.Context, input schema.ProductsInput) error {
+	r := &run{Handler: h, now: time.Now()}
+	r.logger.Printf("input: %+v\n", input)
+	// getIndexOrEmpty
+	index, etag, err := r.getIndexOrEmpty(ctx)
+	if err != nil {
+		return err
+	}
+	// addHistoricalStats
+	key := schema.PartitionKey(r.now)
+	stats, err := r.appendSamples(ctx, key, input.Products, tcinsByName(index.Current))
+	if err != nil {
+		return err
+	}
+	// updateIndex
+	expired, err := r.saveRunToIndex(ctx, index, etag, key, stats, input.Products)
+	if err != nil {
+		return err
+	}
+	r.deletePartitions(ctx, expired)
+	// updateRollups
+	if err := r.updateRollups(ctx, index, r.rollups, r.now.Unix()); err != nil {
+		// the rollups catch up from the raw history on the next run
+		r.logger.Printf("unable to update rollups: %s\n", err)
+	}
+	// updateSummary, with predictions from the hourly rollups
+	if err := r.updateSummary(ctx, index, r.rollups[0], r.retention); err != nil {
+		// the summary is rebuilt from the raw history on the next run
+		r.logger.Printf("unable to update summary: %s\n", err)
+	}
+	// updateDashboard, from the summary saved above
+	if err := r.updateDashboard(ctx, index, r.rollups[0]); err != nil {
+		// the dashboard is rebuilt on the next run
+		r.logger.Printf("unable to update dashboard: %s\n", err)
+	}
+	// updateFeed, from the same window as the summary
+	if err := r.updateFeed(ctx, index, r.retention); err != nil {
+		// the feed is rebuilt from the raw history on the next run
+		r.logger.Printf("unable to update feed: %s\n", err)
+	}
+	// updateExports
+	if err := r.updateExports(ctx, index); err != nil {
+		// the exports are rebuilt from the raw history on the next run
+		r.logger.Printf("unable to update exports: %s\n", err)
+	}
+	return nil
+}
+
+// Config is the configuration of the stats.
+type Config struct {
+	// Store is where the stats are kept.  When it is nil, New opens the store named by StoreKind.
+	Store StatsStore
+	// StoreKind is one of "s3" (the default), "dir" or "memory".  Bucket is the bucket of the "s3" store, and Dir the
+	// directory of the "dir" store.
+	StoreKind string
+	Bucket    string
+	Dir       string
+	// Retention is how long raw samples are kept.
+	Retention time.Duration
+	Rollups   []RollupLevel
+	// CSVExportKey and ParquetExportKey are where the exports are written, or empty to skip them.
+	CSVExportKey     string
+	ParquetExportKey string
+}
+
+// LoadConfig reads the configuration of the stats from the environment.
+func LoadConfig() (Config, error) {
+	cfg := Config{StoreKind: os.Getenv(storeEnv), Bucket: os.Getenv(bucketNameEnv), Dir: os.Getenv(storeDirEnv)}
+	r, err := configureRetention()
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Retention = r
+	levels, err := configureRollups()
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Rollups = levels
+	cfg.CSVExportKey, cfg.ParquetExportKey = configureExports()
+	return cfg, nil
+}
+
+// configureRetention reads how long samples are kept as a Go duration, e.g. "336h".
+func configureRetention() (time.Duration, error) {
+	return parseRetention(retentionEnv, defaultRetention)
+}
+
+// parseRetention reads a positive Go duration from env, or returns def if it is not set.
+func parseRetention(env string, def time.Duration) (time.Duration, error) {
+	raw := os.Getenv(env)
+	if raw == "" {
+		return def, nil
+	}
+	r, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, err
+	}
+	if r <= 0 {
+		return 0, fmt.Errorf("%s must be positive, got %s", env, r)
+	}
+	return r, nil
+}
@@ -0,0 +1,162 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+// errNewerVersion is returned when a document was written by a newer version of this function.  It is not corrupt,
+// so it is left alone.
+var errNewerVersion = errors.New("document is from a newer version")
+
+// documentUpgrade upgrades a document, decoded as generic JSON, to the next version.  Working on generic JSON means
+// older documents can still be read after the structs change.  tcins maps product names to TCINs, for upgrading
+// documents keyed by name.
+type documentUpgrade func(doc map[string]interface{}, tcins map[string]string) error
+
+// statsUpgrades upgrade HistoricalStats documents, keyed by the version they upgrade from.
+var statsUpgrades = map[int]documentUpgrade{
+	1: keyHistoryByTCIN,
+}
+
+// rollupUpgrades upgrade Rollups documents, keyed by the version they upgrade from.
+var rollupUpgrades = map[int]documentUpgrade{
+	1: keyRollupsByTCIN,
+}
+
+// decodeDocument decodes b into v, first applying upgrades with tcins until it is at schema.StatsVersion, and reports
+// if it was upgraded.  A nil upgrades decodes b as it is.
+func decodeDocument(b []byte, v interface{}, upgrades map[int]documentUpgrade, tcins map[string]string) (bool, error) {
+	if upgrades == nil {
+		return false, json.Unmarshal(b, v)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return false, err
+	}
+	version := 1
+	if raw, ok := doc["version"].(float64); ok {
+		version = int(raw)
+	}
+	if version > schema.StatsVersion {
+		return false, fmt.Errorf("%w: version %d", errNewerVersion, version)
+	}
+	if version == schema.StatsVersion {
+		return false, json.Unmarshal(b, v)
+	}
+	for ; version < schema.StatsVersion; version++ {
+		upgrade, ok := upgrades[version]
+		if !ok {
+			return false, fmt.Errorf("no upgrade from version %d", version)
+		}
+		if err := upgrade(doc, tcins); err != nil {
+			return false, fmt.Errorf("upgrading from version %d: %w", version, err)
+		}
+	}
+	doc["version"] = schema.StatsVersion
+	upgraded, err := json.Marshal(doc)
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(upgraded, v)
+}
+
+// saveUpgraded writes back a document that was upgraded when it was read with etag, so it is only upgraded once.
+// When another run has changed it first that is kept, since it will have been upgraded as well.
+func (r *run) saveUpgraded(ctx context.Context, key string, v interface{}, etag string) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := r.store.Put(ctx, key, b, etag); err != nil && !errors.Is(err, errConflict) {
+		return err
+	}
+	r.logger.Printf("upgraded %s to version %d\n", key, schema.StatsVersion)
+	return nil
+}
+
+// tcinsByName maps product names to TCINs from the current state, for upgrading documents keyed by name.  Names used
+// by more than one TCIN are left out, since there is no way to tell their history apart.
+func tcinsByName(products map[string]ProductState) map[string]string {
+	tcins := map[string]string{}
+	ambiguous := map[string]bool{}
+	for _, p := range products {
+		if p.TCIN == "" {
+			continue
+		}
+		if existing, ok := tcins[p.Name]; ok && existing != p.TCIN {
+			ambiguous[p.Name] = true
+		}
+		tcins[p.Name] = p.TCIN
+	}
+	for name := range ambiguous {
+		delete(tcins, name)
+	}
+	return tcins
+}
+
+// keyHistoryByTCIN upgrades history keyed by product name to be keyed by TCIN.  Series that end up with the same TCIN
+// are joined, and history for names without a known TCIN is left keyed by name.
+func keyHistoryByTCIN(doc map[string]interface{}, tcins map[string]string) error {
+	history, ok := doc["history"].([]interface{})
+	if !ok {
+		return nil
+	}
+	keyed := []interface{}{}
+	index := map[string]map[string]interface{}{}
+	for _, item := range history {
+		stat, ok := item.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("history is %T, not an object", item)
+		}
+		name, _ := stat["product_name"].(string)
+		tcin, _ := stat["tcin"].(string)
+		if tcin == "" {
+			tcin = tcins[name]
+			stat["tcin"] = tcin
+		}
+		key := schema.HistoricalStat{TCIN: tcin, ProductName: name}.Key()
+		existing, ok := index[key]
+		if !ok {
+			index[key] = stat
+			keyed = append(keyed, stat)
+			continue
+		}
+		existingData, _ := existing["data"].([]interface{})
+		data, _ := stat["data"].([]interface{})
+		data = append(existingData, data...)
+		sort.SliceStable(data, func(i, j int) bool {
+			return sampleTime(data[i]) < sampleTime(data[j])
+		})
+		existing["data"] = data
+	}
+	doc["history"] = keyed
+	return nil
+}
+
+func sampleTime(sample interface{}) float64 {
+	d, _ := sample.(map[string]interface{})
+	t, _ := d["time"].(float64)
+	return t
+}
+
+// keyRollupsByTCIN upgrades rollups keyed by product name to be keyed by TCIN.
+func keyRollupsByTCIN(doc map[string]interface{}, tcins map[string]string) error {
+	products, _ := doc["products"].([]interface{})
+	for _, item := range products {
+		product, ok := item.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("product is %T, not an object", item)
+		}
+		name, _ := product["product_name"].(string)
+		if tcin, _ := product["tcin"].(string); tcin == "" {
+			product["tcin"] = tcins[name]
+		}
+	}
+	return nil
+}
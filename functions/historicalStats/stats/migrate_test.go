@@ -0,0 +1,169 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/davecgh/go-spew/spew"
+)
+
+func TestDecodeDocument_Stats(t *testing.T) {
+	tcins := map[string]string{"formula": "123"}
+	cases := map[string]struct {
+		fixture          string
+		expected         *HistoricalStats
+		expectedUpgraded bool
+		expectedErr      error
+	}{
+		"Version 1 is keyed by TCIN": {
+			fixture:          "stats_v1.json",
+			expectedUpgraded: true,
+			expected: &HistoricalStats{
+				Version:       schema.StatsVersion,
+				CreatedAt:     1654041600,
+				LastUpdatedAt: 1654084800,
+				History: []HistoricalStat{
+					{
+						TCIN:        "123",
+						ProductName: "renamed formula",
+						Data: []HistoricalData{
+							{Time: 1654081200, Count: 1},
+							{Time: 1654084800, Count: 2, Units: 4, ShippingAvailable: true, ShippingQuantity: 10},
+						},
+					},
+					{ProductName: "old formula", Data: []HistoricalData{{Time: 1654041600}}},
+				},
+			},
+		},
+		"Version 2 is read as is": {
+			fixture: "stats_v2.json",
+			expected: &HistoricalStats{
+				Version:       schema.StatsVersion,
+				CreatedAt:     1654041600,
+				LastUpdatedAt: 1654084800,
+				History: []HistoricalStat{
+					{
+						TCIN:        "123",
+						ProductName: "formula",
+						Data:        []HistoricalData{{Time: 1654084800, Count: 2, Units: 4, ShippingAvailable: true, ShippingQuantity: 10}},
+					},
+				},
+			},
+		},
+		"Newer version is an error": {
+			fixture:     "stats_v3.json",
+			expectedErr: errNewerVersion,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			var actual HistoricalStats
+			upgraded, err := decodeDocument(readFixture(t, tt.fixture), &actual, statsUpgrades, tcins)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("wanted error %v, got %v", tt.expectedErr, err)
+			}
+			if upgraded != tt.expectedUpgraded {
+				t.Errorf("wanted upgraded %t, got %t", tt.expectedUpgraded, upgraded)
+			}
+			if tt.expected != nil && !reflect.DeepEqual(tt.expected, &actual) {
+				t.Error(spew.Printf("%v\n%v", tt.expected, &actual))
+			}
+		})
+	}
+}
+
+func TestDecodeDocument_Rollups(t *testing.T) {
+	tcins := map[string]string{"formula": "123"}
+	cases := map[string]struct {
+		fixture  string
+		expected []ProductRollup
+	}{
+		"Version 1 is keyed by TCIN": {
+			fixture: "rollups_v1.json",
+			expected: []ProductRollup{
+				{TCIN: "123", ProductName: "formula", Buckets: []RollupBucket{{Start: 1654041600, Samples: 2, InStockSamples: 1, Max: 2, Mean: 1, InStockPercent: 50}}},
+				{ProductName: "old formula", Buckets: []RollupBucket{{Start: 1654041600, Samples: 1}}},
+			},
+		},
+		"Version 2 is read as is": {
+			fixture: "rollups_v2.json",
+			expected: []ProductRollup{
+				{TCIN: "123", ProductName: "formula", Buckets: []RollupBucket{{Start: 1654041600, Samples: 2, InStockSamples: 1, Max: 2, Mean: 1, InStockPercent: 50}}},
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			var actual Rollups
+			if _, err := decodeDocument(readFixture(t, tt.fixture), &actual, rollupUpgrades, tcins); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if actual.Version != schema.StatsVersion || actual.BucketSeconds != 86400 {
+				t.Errorf("unexpected rollups: version %d, bucket %d", actual.Version, actual.BucketSeconds)
+			}
+			if !reflect.DeepEqual(tt.expected, actual.Products) {
+				t.Error(spew.Printf("%v\n%v", tt.expected, actual.Products))
+			}
+		})
+	}
+}
+
+func TestGetHistoryRange_Upgrade(t *testing.T) {
+	key := "history/2022-06-01.json"
+	objects := map[string][]byte{key: readFixture(t, "stats_v1.json")}
+	index := &StatsIndex{
+		Current:    map[string]ProductState{"123": {Name: "formula", TCIN: "123"}},
+		Partitions: []PartitionRef{{Key: key, Start: 1654041600, End: 1654084800}},
+	}
+
+	r := testRun(NewMemoryStatsStore(objects), time.Unix(1654084800, 0))
+	if _, err := r.getHistoryRange(context.Background(), index, 1654041600, 1654084800); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var saved map[string]interface{}
+	if err := json.Unmarshal(objects[key], &saved); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if saved["version"] != float64(schema.StatsVersion) {
+		t.Errorf("expected the partition to be saved at version %d, got %v", schema.StatsVersion, saved["version"])
+	}
+	var part HistoricalStats
+	if upgraded, err := decodeDocument(objects[key], &part, statsUpgrades, nil); err != nil || upgraded {
+		t.Fatalf("expected the saved partition to need no upgrade, got %t and %v", upgraded, err)
+	}
+	if part.History[0].TCIN != "123" {
+		t.Error(spew.Sprintf("expected the history to be keyed by TCIN, got %v", part.History))
+	}
+}
+
+func TestTCINsByName(t *testing.T) {
+	products := map[string]ProductState{
+		"123":     {Name: "formula", TCIN: "123"},
+		"456":     {Name: "shared", TCIN: "456"},
+		"789":     {Name: "shared", TCIN: "789"},
+		"no tcin": {Name: "no tcin"},
+	}
+	expected := map[string]string{"formula": "123"}
+
+	if actual := tcinsByName(products); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("wanted %v, got %v", expected, actual)
+	}
+}
+
+func readFixture(t testing.TB, name string) []byte {
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("unable to read fixture: %s", err)
+	}
+	return b
+}
@@ -0,0 +1,241 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// The parts of the Parquet format used by writeParquet.  See https://github.com/apache/parquet-format.  The tests
+// read the files back with a separate reader written from the spec.
+const (
+	parquetMagic = "PAR1"
+	// physical types
+	parquetBoolean   = 0
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetByteArray = 6
+	// converted type for strings
+	parquetUTF8 = 0
+	// repetition type
+	parquetRequired = 0
+	// encodings, page types and codecs
+	parquetPlain        = 0
+	parquetRLE          = 3
+	parquetDataPage     = 0
+	parquetUncompressed = 0
+)
+
+// parquetColumn is a required column with its values already PLAIN encoded.
+type parquetColumn struct {
+	name   string
+	kind   int32
+	utf8   bool
+	values []byte
+}
+
+func int64Column(name string, values []int64) parquetColumn {
+	b := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint64(b[8*i:], uint64(v))
+	}
+	return parquetColumn{name: name, kind: parquetInt64, values: b}
+}
+
+func int32Column(name string, values []int) parquetColumn {
+	b := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(b[4*i:], uint32(int32(v)))
+	}
+	return parquetColumn{name: name, kind: parquetInt32, values: b}
+}
+
+func stringColumn(name string, values []string) parquetColumn {
+	var b bytes.Buffer
+	for _, v := range values {
+		binary.Write(&b, binary.LittleEndian, uint32(len(v)))
+		b.WriteString(v)
+	}
+	return parquetColumn{name: name, kind: parquetByteArray, utf8: true, values: b.Bytes()}
+}
+
+// boolColumn packs the values one bit each, least significant bit first.
+func boolColumn(name string, values []bool) parquetColumn {
+	b := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			b[i/8] |= 1 << (i % 8)
+		}
+	}
+	return parquetColumn{name: name, kind: parquetBoolean, values: b}
+}
+
+// writeParquet writes the columns as a Parquet file with a single row group of uncompressed data pages.  Every
+// column must have numRows values.
+func writeParquet(columns []parquetColumn, numRows int) []byte {
+	var file bytes.Buffer
+	file.WriteString(parquetMagic)
+	offsets := make([]int64, len(columns))
+	sizes := make([]int64, len(columns))
+	for i, c := range columns {
+		header := newThriftWriter()
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(c.values)))
+		header.i32(3, int32(len(c.values)))
+		header.structBegin(5)
+		header.i32(1, int32(numRows))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.structEnd()
+		offsets[i] = int64(file.Len())
+		file.Write(header.bytes())
+		file.Write(c.values)
+		sizes[i] = int64(file.Len()) - offsets[i]
+	}
+
+	meta := newThriftWriter()
+	meta.i32(1, 1)
+	meta.listBegin(2, thriftStruct, len(columns)+1)
+	meta.elemBegin()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(columns)))
+	meta.structEnd()
+	for _, c := range columns {
+		meta.elemBegin()
+		meta.i32(1, c.kind)
+		meta.i32(3, parquetRequired)
+		meta.binary(4, c.name)
+		if c.utf8 {
+			meta.i32(6, parquetUTF8)
+		}
+		meta.structEnd()
+	}
+	meta.i64(3, int64(numRows))
+	if numRows == 0 {
+		meta.listBegin(4, thriftStruct, 0)
+	} else {
+		var total int64
+		meta.listBegin(4, thriftStruct, 1)
+		meta.elemBegin()
+		meta.listBegin(1, thriftStruct, len(columns))
+		for i, c := range columns {
+			meta.elemBegin()
+			meta.i64(2, offsets[i])
+			meta.structBegin(3)
+			meta.i32(1, c.kind)
+			meta.listBegin(2, thriftI32, 1)
+			meta.elemI32(parquetPlain)
+			meta.listBegin(3, thriftBinary, 1)
+			meta.elemBinary(c.name)
+			meta.i32(4, parquetUncompressed)
+			meta.i64(5, int64(numRows))
+			meta.i64(6, sizes[i])
+			meta.i64(7, sizes[i])
+			meta.i64(9, offsets[i])
+			meta.structEnd()
+			meta.structEnd()
+			total += sizes[i]
+		}
+		meta.i64(2, total)
+		meta.i64(3, int64(numRows))
+		meta.structEnd()
+	}
+	meta.binary(6, "target-tracker historicalStats")
+	footer := meta.bytes()
+	file.Write(footer)
+	binary.Write(&file, binary.LittleEndian, uint32(len(footer)))
+	file.WriteString(parquetMagic)
+	return file.Bytes()
+}
+
+// Thrift compact protocol types, as used in field and list headers.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter writes a struct in the Thrift compact protocol, which Parquet uses for its metadata.  Only the field
+// types Parquet needs are supported.
+type thriftWriter struct {
+	buf bytes.Buffer
+	// lastField is the id of the last field written in each open struct, innermost last
+	lastField []int16
+}
+
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{lastField: []int16{0}}
+}
+
+// bytes ends the outermost struct and returns it.
+func (w *thriftWriter) bytes() []byte {
+	w.buf.WriteByte(0)
+	return w.buf.Bytes()
+}
+
+func (w *thriftWriter) fieldHeader(id int16, kind byte) {
+	last := &w.lastField[len(w.lastField)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | kind)
+	} else {
+		w.buf.WriteByte(kind)
+		w.varint(uint64((id << 1) ^ (id >> 15)))
+	}
+	*last = id
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.fieldHeader(id, thriftI32)
+	w.elemI32(v)
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.fieldHeader(id, thriftI64)
+	w.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (w *thriftWriter) binary(id int16, s string) {
+	w.fieldHeader(id, thriftBinary)
+	w.elemBinary(s)
+}
+
+func (w *thriftWriter) structBegin(id int16) {
+	w.fieldHeader(id, thriftStruct)
+	w.elemBegin()
+}
+
+func (w *thriftWriter) structEnd() {
+	w.buf.WriteByte(0)
+	w.lastField = w.lastField[:len(w.lastField)-1]
+}
+
+func (w *thriftWriter) listBegin(id int16, elem byte, size int) {
+	w.fieldHeader(id, thriftList)
+	if size < 15 {
+		w.buf.WriteByte(byte(size)<<4 | elem)
+	} else {
+		w.buf.WriteByte(0xf0 | elem)
+		w.varint(uint64(size))
+	}
+}
+
+// elemBegin starts a struct that is an element of a list.  It is ended with structEnd.
+func (w *thriftWriter) elemBegin() {
+	w.lastField = append(w.lastField, 0)
+}
+
+func (w *thriftWriter) elemI32(v int32) {
+	w.varint(uint64(uint32((v << 1) ^ (v >> 31))))
+}
+
+func (w *thriftWriter) elemBinary(s string) {
+	w.varint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
@@ -0,0 +1,271 @@
+package stats
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// The reader below is written from the Parquet and Thrift compact protocol specs, and shares nothing with
+// writeParquet, so the two can only agree if the file is laid out as the spec says.
+
+// thriftStructValue is a decoded Thrift struct, by field id.  Values are int64, []byte, []interface{} or
+// thriftStructValue.
+type thriftStructValue map[int16]interface{}
+
+type thriftReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *thriftReader) byte() byte {
+	b := r.b[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b[r.pos:])
+	if n <= 0 {
+		panic(fmt.Sprintf("bad varint at %d", r.pos))
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(kind byte) interface{} {
+	switch kind {
+	case 1:
+		return int64(1)
+	case 2:
+		return int64(0)
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, 5, 6:
+		return r.zigzag()
+	case 8:
+		n := int(r.uvarint())
+		b := r.b[r.pos : r.pos+n]
+		r.pos += n
+		return b
+	case 9, 10:
+		header := r.byte()
+		size, elem := int(header>>4), header&0x0f
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = r.value(elem)
+		}
+		return list
+	case 12:
+		return r.structValue()
+	default:
+		panic(fmt.Sprintf("unsupported thrift type %d at %d", kind, r.pos))
+	}
+}
+
+func (r *thriftReader) structValue() thriftStructValue {
+	s := thriftStructValue{}
+	var id int16
+	for {
+		header := r.byte()
+		if header == 0 {
+			return s
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.zigzag())
+		}
+		s[id] = r.value(header & 0x0f)
+	}
+}
+
+// readParquetMeta reads the FileMetaData in the footer of the file.
+func readParquetMeta(t *testing.T, file []byte) thriftStructValue {
+	t.Helper()
+	if string(file[:4]) != "PAR1" || string(file[len(file)-4:]) != "PAR1" {
+		t.Fatal("missing magic number")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	footer := &thriftReader{b: file[len(file)-8-footerLen : len(file)-8]}
+	meta := footer.structValue()
+	if footer.pos != footerLen {
+		t.Fatalf("footer is %d bytes but %d were decoded", footerLen, footer.pos)
+	}
+	return meta
+}
+
+// parquetField is the part of a column's SchemaElement that readers depend on.
+type parquetField struct {
+	Name       string
+	Type       int64
+	Repetition int64
+	UTF8       bool
+}
+
+// readParquetSchema reads the columns of the file's schema.  A string is UTF8 by its converted type, or by the STRING
+// logical type that newer writers add.
+func readParquetSchema(t *testing.T, file []byte) []parquetField {
+	t.Helper()
+	fields := []parquetField{}
+	for _, e := range readParquetMeta(t, file)[2].([]interface{})[1:] {
+		element := e.(thriftStructValue)
+		f := parquetField{Name: string(element[4].([]byte)), Type: element[1].(int64), Repetition: element[3].(int64)}
+		if converted, ok := element[6].(int64); ok && converted == parquetUTF8 {
+			f.UTF8 = true
+		}
+		if logical, ok := element[10].(thriftStructValue); ok {
+			_, f.UTF8 = logical[1]
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// readParquetRows reads a file of required, uncompressed, PLAIN encoded columns into rows of values by column name.
+func readParquetRows(t *testing.T, file []byte) (names []string, rows []map[string]interface{}) {
+	t.Helper()
+	meta := readParquetMeta(t, file)
+	numRows := int(meta[3].(int64))
+	rows = make([]map[string]interface{}, numRows)
+	for i := range rows {
+		rows[i] = map[string]interface{}{}
+	}
+	types := map[string]int64{}
+	for _, e := range meta[2].([]interface{})[1:] {
+		element := e.(thriftStructValue)
+		if element[3].(int64) != 0 {
+			t.Fatalf("column %s is not required", element[4])
+		}
+		names = append(names, string(element[4].([]byte)))
+		types[names[len(names)-1]] = element[1].(int64)
+	}
+	for _, g := range meta[4].([]interface{}) {
+		group := g.(thriftStructValue)
+		for _, c := range group[1].([]interface{}) {
+			column := c.(thriftStructValue)[3].(thriftStructValue)
+			name := string(column[3].([]interface{})[0].([]byte))
+			if column[4].(int64) != 0 {
+				t.Fatalf("column %s is compressed", name)
+			}
+			page := &thriftReader{b: file, pos: int(column[9].(int64))}
+			header := page.structValue()
+			if header[1].(int64) != 0 || header[5].(thriftStructValue)[2].(int64) != 0 {
+				t.Fatalf("column %s is not a PLAIN data page", name)
+			}
+			if n := int(header[5].(thriftStructValue)[1].(int64)); n != numRows {
+				t.Fatalf("column %s has %d values, wanted %d", name, n, numRows)
+			}
+			values := file[page.pos : page.pos+int(header[3].(int64))]
+			for i := range rows {
+				switch types[name] {
+				case 0:
+					rows[i][name] = values[i/8]&(1<<(i%8)) != 0
+				case 1:
+					rows[i][name] = int64(int32(binary.LittleEndian.Uint32(values)))
+					values = values[4:]
+				case 2:
+					rows[i][name] = int64(binary.LittleEndian.Uint64(values))
+					values = values[8:]
+				case 6:
+					n := int(binary.LittleEndian.Uint32(values))
+					rows[i][name] = string(values[4 : 4+n])
+					values = values[4+n:]
+				default:
+					t.Fatalf("column %s has unexpected type %d", name, types[name])
+				}
+			}
+		}
+	}
+	return names, rows
+}
+
+func TestEncodeParquet(t *testing.T) {
+	cases := map[string]struct {
+		rows []exportRow
+	}{
+		"Rows": {
+			rows: []exportRow{
+				{Time: 1654084800, TCIN: "123", ProductName: "formula", StoreID: "1234", StoreQuantity: 3, Count: 2, Units: 4, ShippingAvailable: true, ShippingQuantity: 10},
+				{Time: 1654084800, TCIN: "123", ProductName: "formula", StoreID: "5678", StoreQuantity: -1, Count: 2, Units: 4},
+				{Time: 1654088400, TCIN: "456", ProductName: "fórmula"},
+			},
+		},
+		"More rows than fit in a byte of booleans": {
+			rows: func() []exportRow {
+				rows := []exportRow{}
+				for i := 0; i < 20; i++ {
+					rows = append(rows, exportRow{Time: int64(i), TCIN: "123", ShippingAvailable: i%3 == 0})
+				}
+				return rows
+			}(),
+		},
+		"No rows": {
+			rows: []exportRow{},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			names, actual := readParquetRows(t, encodeParquet(tt.rows))
+
+			if !reflect.DeepEqual(exportColumns, names) {
+				t.Errorf("wanted columns %v, got %v", exportColumns, names)
+			}
+			expected := make([]map[string]interface{}, len(tt.rows))
+			for i, r := range tt.rows {
+				expected[i] = map[string]interface{}{
+					"time": r.Time, "tcin": r.TCIN, "product_name": r.ProductName, "store_id": r.StoreID,
+					"store_quantity": int64(r.StoreQuantity), "count": int64(r.Count), "units": int64(r.Units),
+					"shipping_available": r.ShippingAvailable, "shipping_quantity": int64(r.ShippingQuantity),
+				}
+			}
+			if !reflect.DeepEqual(expected, actual) {
+				t.Error(spew.Printf("%v\n%v", expected, actual))
+			}
+		})
+	}
+}
+
+// parquetGoldenRows are the rows testdata/export_parquet.py writes to testdata/export.parquet.
+var parquetGoldenRows = []exportRow{
+	{Time: 1654084800, TCIN: "123", ProductName: "formula", StoreID: "1234", StoreQuantity: 3, Count: 2, Units: 4, ShippingAvailable: true, ShippingQuantity: 10},
+	{Time: 1654084800, TCIN: "123", ProductName: "formula", StoreID: "5678", StoreQuantity: -1, Count: 2, Units: 4},
+	{Time: 1654088400, TCIN: "456", ProductName: "fórmula"},
+}
+
+// TestEncodeParquet_Golden checks writeParquet against a file pyarrow wrote for the same rows, so the writer agrees
+// with a maintained implementation and not just with the reader above.
+func TestEncodeParquet_Golden(t *testing.T) {
+	golden, err := os.ReadFile(filepath.Join("testdata", "export.parquet"))
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Skip("no golden file, run testdata/export_parquet.py with pyarrow to write it")
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	actual := encodeParquet(parquetGoldenRows)
+
+	if expected, actual := readParquetSchema(t, golden), readParquetSchema(t, actual); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("wanted schema %+v, got %+v", expected, actual)
+	}
+	_, expectedRows := readParquetRows(t, golden)
+	if _, actualRows := readParquetRows(t, actual); !reflect.DeepEqual(expectedRows, actualRows) {
+		t.Error(spew.Printf("%v\n%v", expectedRows, actualRows))
+	}
+}
@@ -0,0 +1,232 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+// legacyStats is the index key as written before history was partitioned, when it held every sample, or before
+// there was a current state, when it held the products from the last run.
+type legacyStats struct {
+	StatsIndex
+	History  []HistoricalStat `json:"history"`
+	Products []schema.Product `json:"products"`
+}
+
+// getIndexOrEmpty reads the stats index, or starts a new one if it does not exist yet.  A corrupt index is rebuilt
+// from the partitions within the retention window.
+// A stats object from before partitioning is split into partitions, which are saved before the index is returned.
+// The partitions keep the version of the stats object, and are upgraded when they are read.
+func (r *run) getIndexOrEmpty(ctx context.Context) (*StatsIndex, string, error) {
+	var ls legacyStats
+	etag, err := r.readJSON(ctx, schema.StatsObjectKey, &ls, nil, nil)
+	if errors.Is(err, errNotFound) && etag != "" {
+		index, err := r.rebuildIndex(ctx)
+		return index, etag, err
+	}
+	if errors.Is(err, errNotFound) {
+		return &StatsIndex{CreatedAt: r.now.Unix()}, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	index := ls.StatsIndex
+	if index.Current == nil && len(ls.Products) > 0 {
+		index.Current = stateFromProducts(ls.Products, index.LastUpdatedAt)
+	}
+	if len(index.Partitions) == 0 && len(ls.History) > 0 {
+		r.logger.Println("splitting stats into partitions")
+		for key, part := range splitByDay(ls.History) {
+			part.CreatedAt = index.CreatedAt
+			part.LastUpdatedAt = index.LastUpdatedAt
+			if err := r.saveStats(ctx, key, part, ""); err != nil {
+				return nil, "", err
+			}
+			updateIndex(&index, key, part)
+		}
+	}
+	return &index, etag, nil
+}
+
+// rebuildIndex finds the partitions for each day in the retention window.  The current state is lost, and starts
+// again with this run.
+func (r *run) rebuildIndex(ctx context.Context) (*StatsIndex, error) {
+	r.logger.Println("rebuilding the stats index from partitions")
+	index := &StatsIndex{CreatedAt: r.now.Add(-r.retention).Unix()}
+	for day := r.now.Add(-r.retention).UTC().Truncate(24 * time.Hour); !day.After(r.now); day = day.Add(24 * time.Hour) {
+		key := schema.PartitionKey(day)
+		part, _, err := r.getCurrentStatsOrEmpty(ctx, key, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(part.History) > 0 {
+			updateIndex(index, key, part)
+		}
+	}
+	return index, nil
+}
+
+// splitByDay groups samples into the partitions they belong in, keyed by partition key.
+func splitByDay(history []HistoricalStat) map[string]*HistoricalStats {
+	parts := map[string]*HistoricalStats{}
+	for _, stat := range history {
+		for _, d := range stat.Data {
+			key := schema.PartitionKey(time.Unix(d.Time, 0))
+			part, ok := parts[key]
+			if !ok {
+				part = &HistoricalStats{}
+				parts[key] = part
+			}
+			if n := len(part.History); n == 0 || part.History[n-1].Key() != stat.Key() {
+				part.History = append(part.History, HistoricalStat{TCIN: stat.TCIN, ProductName: stat.ProductName})
+			}
+			n := len(part.History) - 1
+			part.History[n].Data = append(part.History[n].Data, d)
+		}
+	}
+	return parts
+}
+
+// updateIndex records the time span of the partition at key, adding it to the index if it is new.  The span is only
+// ever widened.  Partitions are kept in key order, which is also time order.
+func updateIndex(index *StatsIndex, key string, part *HistoricalStats) {
+	ref := PartitionRef{Key: key}
+	empty := true
+	for _, stat := range part.History {
+		for _, d := range stat.Data {
+			if empty || d.Time < ref.Start {
+				ref.Start = d.Time
+			}
+			if empty || d.Time > ref.End {
+				ref.End = d.Time
+			}
+			empty = false
+		}
+	}
+	for i, existing := range index.Partitions {
+		if existing.Key != key {
+			continue
+		}
+		// another run may have added samples that this one has not seen
+		if empty || existing.Start < ref.Start {
+			ref.Start = existing.Start
+		}
+		if empty || existing.End > ref.End {
+			ref.End = existing.End
+		}
+		index.Partitions[i] = ref
+		return
+	}
+	index.Partitions = append(index.Partitions, ref)
+	sort.Slice(index.Partitions, func(i, j int) bool {
+		return index.Partitions[i].Key < index.Partitions[j].Key
+	})
+}
+
+// pruneIndex drops partitions whose samples are all older than the retention window and returns their keys.
+// CreatedAt is moved up to the start of the window so it always describes the oldest data that may be present.
+func pruneIndex(index *StatsIndex, procTime time.Time, retention time.Duration) []string {
+	cutoff := procTime.Add(-retention).Unix()
+	kept := []PartitionRef{}
+	expired := []string{}
+	for _, ref := range index.Partitions {
+		if ref.End < cutoff {
+			expired = append(expired, ref.Key)
+		} else {
+			kept = append(kept, ref)
+		}
+	}
+	index.Partitions = kept
+	if index.CreatedAt < cutoff {
+		index.CreatedAt = cutoff
+	}
+	return expired
+}
+
+// saveIndex writes the stats index if it has not changed since it was read with etag.
+func saveIndex(ctx context.Context, store StatsStore, index *StatsIndex, etag string) error {
+	b, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, schema.StatsObjectKey, b, etag)
+}
+
+// saveRunToIndex records the partition written by this run and the products in the index, drops partitions past the
+// retention window, and saves it.  If another run changes the index before it is saved, the index is read again and
+// the changes are made to that, up to maxWriteAttempts times.  It returns the keys of the dropped partitions.
+func (r *run) saveRunToIndex(ctx context.Context, index *StatsIndex, etag, key string, part *HistoricalStats, products []schema.Product) ([]string, error) {
+	for attempt := 1; ; attempt++ {
+		updateIndex(index, key, part)
+		expired := pruneIndex(index, r.now, r.retention)
+		if len(expired) > 0 {
+			r.logger.Printf("pruned %d partitions older than %s\n", len(expired), r.retention)
+		}
+		updateState(index, products, r.now)
+		index.LastUpdatedAt = r.now.Unix()
+		err := saveIndex(ctx, r.store, index, etag)
+		if !errors.Is(err, errConflict) || attempt == maxWriteAttempts {
+			return expired, err
+		}
+		r.logger.Printf("%s was changed by another run, retrying\n", schema.StatsObjectKey)
+		latest, latestEtag, err := r.getIndexOrEmpty(ctx)
+		if err != nil {
+			return nil, err
+		}
+		*index, etag = *latest, latestEtag
+	}
+}
+
+// deletePartitions removes partitions that are no longer in the index.  Failures are logged, since the partitions
+// are not read once they are out of the index.
+func (r *run) deletePartitions(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := r.store.Delete(ctx, key); err != nil {
+			r.logger.Printf("unable to delete partition %s: %s\n", key, err)
+		}
+	}
+}
+
+// getHistoryRange reads the partitions in the index that overlap from and to, and returns their samples between
+// from and to inclusive.  A partition from an older version is upgraded using the TCINs in the index's current state,
+// and written back.
+func (r *run) getHistoryRange(ctx context.Context, index *StatsIndex, from, to int64) (*HistoricalStats, error) {
+	partitions := []HistoricalStats{}
+	tcins := tcinsByName(index.Current)
+	for _, ref := range index.Partitions {
+		if !ref.Overlaps(from, to) {
+			continue
+		}
+		b, etag, err := r.store.Get(ctx, ref.Key)
+		if errors.Is(err, errCorrupt) {
+			r.logger.Printf("skipping corrupt partition %s\n", ref.Key)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var part HistoricalStats
+		upgraded, err := decodeDocument(b, &part, statsUpgrades, tcins)
+		if err != nil {
+			r.logger.Printf("skipping partition %s: %s\n", ref.Key, err)
+			continue
+		}
+		if upgraded {
+			if err := r.saveUpgraded(ctx, ref.Key, &part, etag); err != nil {
+				// it is upgraded again the next time it is read
+				r.logger.Printf("unable to save upgraded partition %s: %s\n", ref.Key, err)
+			}
+		}
+		partitions = append(partitions, part)
+	}
+	return &HistoricalStats{
+		CreatedAt:     index.CreatedAt,
+		LastUpdatedAt: index.LastUpdatedAt,
+		History:       schema.MergeHistory(partitions, from, to),
+	}, nil
+}
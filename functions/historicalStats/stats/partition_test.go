@@ -0,0 +1,258 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/davecgh/go-spew/spew"
+)
+
+func TestGetIndexOrEmpty(t *testing.T) {
+	day := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	cases := map[string]struct {
+		objects      map[string][]byte
+		expected     *StatsIndex
+		expectedKeys []string
+	}{
+		"Missing index returns empty index": {
+			objects:  map[string][]byte{},
+			expected: &StatsIndex{CreatedAt: day.Unix()},
+		},
+		"Existing index is returned": {
+			objects: map[string][]byte{
+				schema.StatsObjectKey: mustMarshal(t, StatsIndex{
+					CreatedAt:  day.Unix(),
+					Partitions: []PartitionRef{{Key: "history/2022-06-01.json", Start: day.Unix(), End: day.Unix()}},
+				}),
+			},
+			expected: &StatsIndex{
+				CreatedAt:  day.Unix(),
+				Partitions: []PartitionRef{{Key: "history/2022-06-01.json", Start: day.Unix(), End: day.Unix()}},
+			},
+		},
+		"Corrupt index is rebuilt from partitions": {
+			objects: map[string][]byte{
+				schema.StatsObjectKey: []byte("{"),
+				"history/2022-05-30.json": mustMarshal(t, HistoricalStats{History: []HistoricalStat{
+					{TCIN: "123", Data: []HistoricalData{{Time: day.Add(-48 * time.Hour).Unix()}}},
+				}}),
+			},
+			expected: &StatsIndex{
+				CreatedAt:  day.Add(-defaultRetention).Unix(),
+				Partitions: []PartitionRef{{Key: "history/2022-05-30.json", Start: day.Add(-48 * time.Hour).Unix(), End: day.Add(-48 * time.Hour).Unix()}},
+			},
+			expectedKeys: []string{quarantineKey(schema.StatsObjectKey, day, []byte("{"))},
+		},
+		"Stats from before partitioning are split by day": {
+			objects: map[string][]byte{
+				schema.StatsObjectKey: mustMarshal(t, HistoricalStats{
+					CreatedAt: day.Add(-24 * time.Hour).Unix(),
+					History: []HistoricalStat{
+						{
+							ProductName: "formula",
+							Data: []HistoricalData{
+								{Time: day.Add(-24 * time.Hour).Unix(), Count: 1},
+								{Time: day.Add(-23 * time.Hour).Unix(), Count: 2},
+								{Time: day.Unix(), Count: 3},
+							},
+						},
+					},
+				}),
+			},
+			expected: &StatsIndex{
+				CreatedAt: day.Add(-24 * time.Hour).Unix(),
+				Partitions: []PartitionRef{
+					{Key: "history/2022-05-31.json", Start: day.Add(-24 * time.Hour).Unix(), End: day.Add(-23 * time.Hour).Unix()},
+					{Key: "history/2022-06-01.json", Start: day.Unix(), End: day.Unix()},
+				},
+			},
+			expectedKeys: []string{"history/2022-05-31.json", "history/2022-06-01.json"},
+		},
+		"Products from the last run become the current state": {
+			objects: map[string][]byte{
+				schema.StatsObjectKey: []byte(`{"created_at":1,"last_updated_at":1654084800,"products":[` +
+					`{"name":"formula","tcin":"123","result":{"pickup":{"stores":[],"total_stores":2}}}]}`),
+			},
+			expected: &StatsIndex{
+				CreatedAt:     1,
+				LastUpdatedAt: day.Unix(),
+				Current: map[string]ProductState{"123": {
+					TCIN: "123", Name: "formula", LastChecked: day.Unix(), LastInStock: day.Unix(), Status: schema.StatusInStock,
+					Result: schema.ProductResult{Pickup: schema.PickupResult{Stores: []schema.StoreResult{}, TotalStores: 2}},
+				}},
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, _, err := testRun(NewMemoryStatsStore(tt.objects), day).getIndexOrEmpty(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(tt.expected, actual) {
+				t.Error(spew.Printf("%v\n%v", tt.expected, actual))
+			}
+			for _, key := range tt.expectedKeys {
+				if _, ok := tt.objects[key]; !ok {
+					t.Errorf("expected partition %s to be saved", key)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateIndex(t *testing.T) {
+	part := &HistoricalStats{
+		History: []HistoricalStat{
+			{ProductName: "formula", Data: []HistoricalData{{Time: 20}, {Time: 30}}},
+			{ProductName: "other formula", Data: []HistoricalData{{Time: 10}}},
+		},
+	}
+	cases := map[string]struct {
+		index    *StatsIndex
+		expected []PartitionRef
+	}{
+		"New partition is added in key order": {
+			index: &StatsIndex{Partitions: []PartitionRef{{Key: "history/2022-06-02.json"}}},
+			expected: []PartitionRef{
+				{Key: "history/2022-06-01.json", Start: 10, End: 30},
+				{Key: "history/2022-06-02.json"},
+			},
+		},
+		"Existing partition is updated": {
+			index:    &StatsIndex{Partitions: []PartitionRef{{Key: "history/2022-06-01.json", Start: 10, End: 20}}},
+			expected: []PartitionRef{{Key: "history/2022-06-01.json", Start: 10, End: 30}},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			updateIndex(tt.index, "history/2022-06-01.json", part)
+			if !reflect.DeepEqual(tt.expected, tt.index.Partitions) {
+				t.Error(spew.Printf("%v\n%v", tt.expected, tt.index.Partitions))
+			}
+		})
+	}
+}
+
+func TestPruneIndex(t *testing.T) {
+	now := time.Now()
+	retention := 7 * 24 * time.Hour
+	daysAgo := func(d int) int64 { return now.Add(time.Duration(-d) * 24 * time.Hour).Unix() }
+	cases := map[string]struct {
+		index           *StatsIndex
+		expected        *StatsIndex
+		expectedExpired []string
+	}{
+		"old partitions are pruned and recent partitions remain": {
+			index: &StatsIndex{
+				CreatedAt: daysAgo(10),
+				Partitions: []PartitionRef{
+					{Key: "old", Start: daysAgo(10), End: daysAgo(9)},
+					{Key: "partial", Start: daysAgo(8), End: daysAgo(6)},
+					{Key: "new", Start: daysAgo(1), End: daysAgo(0)},
+				},
+			},
+			expected: &StatsIndex{
+				CreatedAt: daysAgo(7),
+				Partitions: []PartitionRef{
+					{Key: "partial", Start: daysAgo(8), End: daysAgo(6)},
+					{Key: "new", Start: daysAgo(1), End: daysAgo(0)},
+				},
+			},
+			expectedExpired: []string{"old"},
+		},
+		"new index remains": {
+			index: &StatsIndex{
+				CreatedAt:  now.Add(-10 * time.Minute).Unix(),
+				Partitions: []PartitionRef{{Key: "new", Start: now.Unix(), End: now.Unix()}},
+			},
+			expected: &StatsIndex{
+				CreatedAt:  now.Add(-10 * time.Minute).Unix(),
+				Partitions: []PartitionRef{{Key: "new", Start: now.Unix(), End: now.Unix()}},
+			},
+			expectedExpired: []string{},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			expired := pruneIndex(tt.index, now, retention)
+			if !reflect.DeepEqual(tt.expected, tt.index) {
+				t.Error(spew.Printf("%v\n%v", tt.expected, tt.index))
+			}
+			if !reflect.DeepEqual(tt.expectedExpired, expired) {
+				t.Errorf("wanted expired %v, got %v", tt.expectedExpired, expired)
+			}
+		})
+	}
+}
+
+func TestHandler_Partitions(t *testing.T) {
+	objects := map[string][]byte{}
+	h := testHandler(NewMemoryStatsStore(objects))
+	input := schema.ProductsInput{Products: []schema.Product{{ProductQuery: schema.ProductQuery{Name: "formula"}}}}
+
+	for i := 0; i < 2; i++ {
+		if err := h.Handle(context.Background(), input); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	var index StatsIndex
+	if err := json.Unmarshal(objects[schema.StatsObjectKey], &index); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(index.Partitions) != 1 || len(index.Current) != 1 {
+		t.Fatal(spew.Sprintf("unexpected index: %v", index))
+	}
+	var part HistoricalStats
+	if err := json.Unmarshal(objects[index.Partitions[0].Key], &part); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(part.History) != 1 || len(part.History[0].Data) != 2 {
+		t.Error(spew.Sprintf("expected both runs in one partition: %v", part))
+	}
+}
+
+func TestSaveRunToIndex_Conflict(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	key := schema.PartitionKey(now)
+	store := &racingStore{MemoryStatsStore: NewMemoryStatsStore(nil), races: 1, race: func(objects map[string][]byte) {
+		objects[schema.StatsObjectKey] = mustMarshal(t, StatsIndex{
+			Partitions: []PartitionRef{{Key: key, Start: now.Unix() - 60, End: now.Unix() - 60}},
+		})
+	}}
+	r := testRun(store, now)
+	index, etag, err := r.getIndexOrEmpty(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	part := &HistoricalStats{History: []HistoricalStat{{TCIN: "123", Data: []HistoricalData{{Time: now.Unix()}}}}}
+
+	if _, err := r.saveRunToIndex(context.Background(), index, etag, key, part, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var saved StatsIndex
+	if err := json.Unmarshal(store.objects[schema.StatsObjectKey], &saved); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := PartitionRef{Key: key, Start: now.Unix() - 60, End: now.Unix()}
+	if len(saved.Partitions) != 1 || saved.Partitions[0] != expected {
+		t.Error(spew.Sprintf("wanted %v, got %v", expected, saved.Partitions))
+	}
+}
+
+func mustMarshal(t testing.TB, v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return b
+}
@@ -0,0 +1,130 @@
+package stats
+
+import "time"
+
+const (
+	hoursPerWeek = 7 * 24
+	// forecastHours is how far ahead the forecast in the summary looks.
+	forecastHours = 24
+)
+
+// weeklyPattern is how a product's availability varies over the hours of the week, learned from hourly rollups.
+// Each array is indexed by hourOfWeek.
+type weeklyPattern struct {
+	samples  [hoursPerWeek]int
+	inStock  [hoursPerWeek]int
+	restocks [hoursPerWeek]int
+	// weeks is the number of hourly buckets seen for each hour of the week, which is one per week.
+	weeks [hoursPerWeek]int
+}
+
+// hourOfWeek is the number of hours since the start of the week, Sunday 00:00 UTC.
+func hourOfWeek(t time.Time) int {
+	t = t.UTC()
+	return int(t.Weekday())*24 + t.Hour()
+}
+
+// learnPattern builds the weekly pattern from a product's hourly rollup buckets, which must be in time order.  A
+// restock is a bucket with stores directly after an hour without any.
+func learnPattern(buckets []RollupBucket) weeklyPattern {
+	var p weeklyPattern
+	for i, b := range buckets {
+		h := hourOfWeek(time.Unix(b.Start, 0))
+		p.samples[h] += b.Samples
+		p.inStock[h] += b.InStockSamples
+		p.weeks[h]++
+		if i > 0 && b.InStockSamples > 0 {
+			prev := buckets[i-1]
+			if prev.Start == b.Start-int64(time.Hour.Seconds()) && prev.Samples > 0 && prev.InStockSamples == 0 {
+				p.restocks[h]++
+			}
+		}
+	}
+	return p
+}
+
+// window estimates the hour starting at start from the same hour in past weeks.
+func (p weeklyPattern) window(start time.Time) ForecastWindow {
+	h := hourOfWeek(start)
+	w := ForecastWindow{Start: start.Unix(), End: start.Add(time.Hour).Unix(), Weeks: p.weeks[h]}
+	if p.samples[h] > 0 {
+		w.InStockProbability = float64(p.inStock[h]) / float64(p.samples[h])
+	}
+	if p.weeks[h] > 0 {
+		w.RestockProbability = float64(p.restocks[h]) / float64(p.weeks[h])
+	}
+	return w
+}
+
+// forecast estimates each of the hours hours after the one now is in.
+func (p weeklyPattern) forecast(now time.Time, hours int) []ForecastWindow {
+	windows := []ForecastWindow{}
+	start := now.UTC().Truncate(time.Hour)
+	for i := 1; i <= hours; i++ {
+		windows = append(windows, p.window(start.Add(time.Duration(i)*time.Hour)))
+	}
+	return windows
+}
+
+// likelyRestock is the hour in the week after now with the best chance of a restock, the earliest if several tie.
+// It is nil if no restocks have been seen.
+func (p weeklyPattern) likelyRestock(now time.Time) *ForecastWindow {
+	var best *ForecastWindow
+	for _, w := range p.forecast(now, hoursPerWeek) {
+		if w.RestockProbability > 0 && (best == nil || w.RestockProbability > best.RestockProbability) {
+			w := w
+			best = &w
+		}
+	}
+	return best
+}
+
+// storeBuckets groups the samples that recorded their stores into hourly buckets for a single store, like the hourly
+// rollups but in stock when the store has the product.  Samples must be in time order.
+func storeBuckets(data []HistoricalData, storeID string) []RollupBucket {
+	buckets := []RollupBucket{}
+	for _, d := range recordedStores(data) {
+		start := time.Unix(d.Time, 0).UTC().Truncate(time.Hour).Unix()
+		n := len(buckets)
+		if n == 0 || buckets[n-1].Start != start {
+			buckets = append(buckets, RollupBucket{Start: start})
+			n++
+		}
+		buckets[n-1].Samples++
+		if d.Stores.Quantity(storeID) > 0 {
+			buckets[n-1].InStockSamples++
+		}
+	}
+	return buckets
+}
+
+// addPredictions adds the forecast and likely restock for each product in the summary from its hourly rollups, and
+// for each of its stores from its raw history, since the rollups are not broken down by store.  Products without
+// rollups are left without predictions.
+func addPredictions(summary *Summary, hourly *Rollups, history []HistoricalStat, now time.Time) {
+	for i := range summary.Products {
+		product := &summary.Products[i]
+		key := product.Key()
+		for _, r := range hourly.Products {
+			if r.Key() != key {
+				continue
+			}
+			pattern := learnPattern(r.Buckets)
+			product.Forecast = pattern.forecast(now, forecastHours)
+			product.LikelyRestock = pattern.likelyRestock(now)
+			break
+		}
+		for _, stat := range history {
+			if stat.Key() != key {
+				continue
+			}
+			for j := range product.Stores {
+				store := &product.Stores[j]
+				pattern := learnPattern(storeBuckets(stat.Data, store.StoreID))
+				store.Forecast = pattern.forecast(now, forecastHours)
+				store.LikelyRestock = pattern.likelyRestock(now)
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// testBuckets are two weeks of hourly rollups.  Tuesday 09:00 has a restock both weeks and Thursday 15:00 only the first.
+func testBuckets() []RollupBucket {
+	at := func(month time.Month, day, hour int) int64 {
+		return time.Date(2022, month, day, hour, 0, 0, 0, time.UTC).Unix()
+	}
+	return []RollupBucket{
+		{Start: at(time.May, 26, 14), Samples: 1},
+		{Start: at(time.May, 26, 15), Samples: 1, InStockSamples: 1},
+		{Start: at(time.May, 31, 8), Samples: 2},
+		{Start: at(time.May, 31, 9), Samples: 2, InStockSamples: 2},
+		{Start: at(time.June, 2, 14), Samples: 1, InStockSamples: 1},
+		{Start: at(time.June, 2, 15), Samples: 1, InStockSamples: 1},
+		{Start: at(time.June, 7, 8), Samples: 2},
+		{Start: at(time.June, 7, 9), Samples: 2, InStockSamples: 1},
+	}
+}
+
+func TestWeeklyPattern_Forecast(t *testing.T) {
+	pattern := learnPattern(testBuckets())
+	// a Thursday
+	now := time.Date(2022, 6, 9, 13, 30, 0, 0, time.UTC)
+	expected := []ForecastWindow{
+		{Start: now.Add(30 * time.Minute).Unix(), End: now.Add(90 * time.Minute).Unix(), InStockProbability: 0.5, Weeks: 2},
+		{Start: now.Add(90 * time.Minute).Unix(), End: now.Add(150 * time.Minute).Unix(), InStockProbability: 1, RestockProbability: 0.5, Weeks: 2},
+		{Start: now.Add(150 * time.Minute).Unix(), End: now.Add(210 * time.Minute).Unix()},
+	}
+
+	actual := pattern.forecast(now, 3)
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Error(spew.Printf("%v\n%v", expected, actual))
+	}
+}
+
+func TestWeeklyPattern_LikelyRestock(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2022, 6, 8, 12, 0, 0, 0, time.UTC)
+	tuesday := time.Date(2022, 6, 14, 9, 0, 0, 0, time.UTC)
+	cases := map[string]struct {
+		buckets  []RollupBucket
+		expected *ForecastWindow
+	}{
+		"Hour with the most restocks": {
+			buckets: testBuckets(),
+			expected: &ForecastWindow{
+				Start: tuesday.Unix(), End: tuesday.Add(time.Hour).Unix(), InStockProbability: 0.75, RestockProbability: 1, Weeks: 2,
+			},
+		},
+		"No restocks": {
+			buckets: []RollupBucket{{Start: now.Add(-time.Hour).Unix(), Samples: 1, InStockSamples: 1}},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual := learnPattern(tt.buckets).likelyRestock(now)
+			if !reflect.DeepEqual(tt.expected, actual) {
+				t.Error(spew.Printf("%v\n%v", tt.expected, actual))
+			}
+		})
+	}
+}
+
+func TestAddPredictions(t *testing.T) {
+	now := time.Date(2022, 6, 8, 12, 0, 0, 0, time.UTC)
+	summary := &Summary{Products: []ProductSummary{
+		{TCIN: "123", ProductName: "formula", Stores: []StoreSummary{{StoreID: "1234"}, {StoreID: "5678"}}},
+		{TCIN: "456", ProductName: "other formula"},
+	}}
+	hourly := &Rollups{Products: []ProductRollup{{TCIN: "123", ProductName: "old name", Buckets: testBuckets()}}}
+	// store 1234 is restocked at 09:00 on Tuesday, and 5678 is never out of stock
+	tuesday := time.Date(2022, 6, 7, 8, 30, 0, 0, time.UTC)
+	history := []HistoricalStat{{TCIN: "123", ProductName: "formula", Data: []HistoricalData{
+		{Time: tuesday.Unix(), Count: 1, Stores: schema.StoreSamples{{StoreID: "5678", Quantity: 1}}},
+		{Time: tuesday.Add(time.Hour).Unix(), Count: 2, Stores: schema.StoreSamples{{StoreID: "1234", Quantity: 3}, {StoreID: "5678", Quantity: 1}}},
+	}}}
+	nextTuesday := time.Date(2022, 6, 14, 9, 0, 0, 0, time.UTC)
+
+	addPredictions(summary, hourly, history, now)
+
+	if p := summary.Products[0]; len(p.Forecast) != forecastHours || p.LikelyRestock == nil {
+		t.Error(spew.Sprintf("expected predictions for the product with rollups: %v", p))
+	}
+	expected := &ForecastWindow{Start: nextTuesday.Unix(), End: nextTuesday.Add(time.Hour).Unix(), InStockProbability: 1, RestockProbability: 1, Weeks: 1}
+	if s := summary.Products[0].Stores[0]; len(s.Forecast) != forecastHours || !reflect.DeepEqual(expected, s.LikelyRestock) {
+		t.Error(spew.Sprintf("expected predictions for the store from its history: %v", s))
+	}
+	if s := summary.Products[0].Stores[1]; len(s.Forecast) != forecastHours || s.LikelyRestock != nil {
+		t.Error(spew.Sprintf("expected no likely restock for a store that never ran out: %v", s))
+	}
+	if p := summary.Products[1]; p.Forecast != nil || p.LikelyRestock != nil {
+		t.Error(spew.Sprintf("expected no predictions without rollups: %v", p))
+	}
+}
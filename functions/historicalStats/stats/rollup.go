@@ -0,0 +1,188 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+const (
+	hourlyRollupRetentionEnv = "HOURLY_ROLLUP_RETENTION"
+	dailyRollupRetentionEnv  = "DAILY_ROLLUP_RETENTION"
+	// 30 days
+	defaultHourlyRollupRetention = 30 * 24 * time.Hour
+	// 1 year
+	defaultDailyRollupRetention = 365 * 24 * time.Hour
+)
+
+// RollupLevel is a single set of rollups, with the size of its buckets and how long they are kept.
+type RollupLevel struct {
+	Key        string
+	Resolution time.Duration
+	Retention  time.Duration
+}
+
+// updateRollups adds the samples taken since each level was last updated and drops buckets past its retention.
+// since is the time of the earliest sample added by this run.  A retried or concurrent run can add a sample before
+// the last update, so every bucket from the one containing since, or the last update if that is earlier, is rebuilt
+// from the raw history rather than added to.  A level that does not exist yet is built from the raw history that is
+// still kept.
+func (r *run) updateRollups(ctx context.Context, index *StatsIndex, levels []RollupLevel, since int64) error {
+	for _, level := range levels {
+		rollups, etag, err := r.getRollupsOrEmpty(ctx, level, tcinsByName(index.Current))
+		if err != nil {
+			return err
+		}
+		from := rollups.LastUpdatedAt + 1
+		if since < from {
+			from = since
+		}
+		if cutoff := r.now.Add(-level.Retention).Unix(); from < cutoff {
+			from = cutoff
+		}
+		from = time.Unix(from, 0).UTC().Truncate(level.Resolution).Unix()
+		dropBuckets(rollups, from)
+		history, err := r.getHistoryRange(ctx, index, from, r.now.Unix())
+		if err != nil {
+			return err
+		}
+		for _, stat := range history.History {
+			addToRollups(rollups, stat, level.Resolution)
+		}
+		pruneRollups(rollups, r.now, level)
+		b, err := json.Marshal(rollups)
+		if err != nil {
+			return err
+		}
+		if err := r.store.Put(ctx, level.Key, b, etag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropBuckets removes the buckets starting at or after from, so they can be rebuilt.
+func dropBuckets(rollups *Rollups, from int64) {
+	for i, p := range rollups.Products {
+		buckets := []RollupBucket{}
+		for _, b := range p.Buckets {
+			if b.Start < from {
+				buckets = append(buckets, b)
+			}
+		}
+		rollups.Products[i].Buckets = buckets
+	}
+}
+
+func (r *run) getRollupsOrEmpty(ctx context.Context, level RollupLevel, tcins map[string]string) (*Rollups, string, error) {
+	var rollups Rollups
+	etag, err := r.readJSON(ctx, level.Key, &rollups, rollupUpgrades, tcins)
+	if errors.Is(err, errNotFound) {
+		r.logger.Printf("building %s from history\n", level.Key)
+		return &Rollups{Version: schema.StatsVersion, BucketSeconds: int64(level.Resolution.Seconds())}, etag, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &rollups, etag, nil
+}
+
+// addToRollups adds the samples for a product to the bucket each falls in.  Samples are added in time order, as runs
+// that overlap may have saved them out of order.
+func addToRollups(rollups *Rollups, stat HistoricalStat, resolution time.Duration) {
+	idx := -1
+	for i, p := range rollups.Products {
+		if p.Key() == stat.Key() {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		rollups.Products = append(rollups.Products, ProductRollup{TCIN: stat.TCIN})
+		idx = len(rollups.Products) - 1
+	}
+	product := &rollups.Products[idx]
+	product.ProductName = stat.ProductName
+	data := append([]HistoricalData{}, stat.Data...)
+	sort.SliceStable(data, func(i, j int) bool { return data[i].Time < data[j].Time })
+	for _, d := range data {
+		start := time.Unix(d.Time, 0).UTC().Truncate(resolution).Unix()
+		n := len(product.Buckets)
+		if n == 0 || product.Buckets[n-1].Start != start {
+			product.Buckets = append(product.Buckets, RollupBucket{Start: start, Min: d.Count, Max: d.Count})
+			n++
+		}
+		addToBucket(&product.Buckets[n-1], d)
+		if d.Time > rollups.LastUpdatedAt {
+			rollups.LastUpdatedAt = d.Time
+		}
+	}
+}
+
+func addToBucket(b *RollupBucket, d HistoricalData) {
+	if d.Count < b.Min {
+		b.Min = d.Count
+	}
+	if d.Count > b.Max {
+		b.Max = d.Count
+	}
+	b.Mean = (b.Mean*float64(b.Samples) + float64(d.Count)) / float64(b.Samples+1)
+	b.Samples++
+	if d.Count > 0 {
+		b.InStockSamples++
+		if b.FirstInStock == 0 {
+			b.FirstInStock = d.Time
+		}
+		b.LastInStock = d.Time
+	}
+	b.InStockPercent = 100 * float64(b.InStockSamples) / float64(b.Samples)
+	if d.Units > b.MaxUnits {
+		b.MaxUnits = d.Units
+	}
+	if d.ShippingAvailable {
+		b.ShippingSamples++
+		if b.FirstShipping == 0 {
+			b.FirstShipping = d.Time
+		}
+	}
+	b.ShippingPercent = 100 * float64(b.ShippingSamples) / float64(b.Samples)
+}
+
+// pruneRollups drops buckets that ended before the retention window, and any product left without buckets.
+func pruneRollups(rollups *Rollups, procTime time.Time, level RollupLevel) {
+	cutoff := procTime.Add(-level.Retention).Unix()
+	products := []ProductRollup{}
+	for _, p := range rollups.Products {
+		buckets := []RollupBucket{}
+		for _, b := range p.Buckets {
+			if b.Start+int64(level.Resolution.Seconds()) > cutoff {
+				buckets = append(buckets, b)
+			}
+		}
+		if len(buckets) > 0 {
+			p.Buckets = buckets
+			products = append(products, p)
+		}
+	}
+	rollups.Products = products
+}
+
+// configureRollups reads how long each level of rollups is kept.
+func configureRollups() ([]RollupLevel, error) {
+	hourly, err := parseRetention(hourlyRollupRetentionEnv, defaultHourlyRollupRetention)
+	if err != nil {
+		return nil, err
+	}
+	daily, err := parseRetention(dailyRollupRetentionEnv, defaultDailyRollupRetention)
+	if err != nil {
+		return nil, err
+	}
+	return []RollupLevel{
+		{Key: schema.HourlyRollupKey, Resolution: time.Hour, Retention: hourly},
+		{Key: schema.DailyRollupKey, Resolution: 24 * time.Hour, Retention: daily},
+	}, nil
+}
@@ -0,0 +1,168 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/davecgh/go-spew/spew"
+)
+
+func TestAddToRollups(t *testing.T) {
+	hour := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(m int) int64 { return hour.Add(time.Duration(m) * time.Minute).Unix() }
+	cases := map[string]struct {
+		rollups  *Rollups
+		stat     HistoricalStat
+		expected []ProductRollup
+	}{
+		"samples are aggregated into buckets": {
+			rollups: &Rollups{},
+			stat: HistoricalStat{
+				ProductName: "formula",
+				Data: []HistoricalData{
+					{Time: at(0), Count: 0, ShippingAvailable: true},
+					{Time: at(20), Count: 4, Units: 9},
+					{Time: at(40), Count: 2, Units: 3},
+					{Time: at(60), Count: 1, Units: 1},
+				},
+			},
+			expected: []ProductRollup{
+				{
+					ProductName: "formula",
+					Buckets: []RollupBucket{
+						{
+							Start: at(0), Samples: 3, InStockSamples: 2, Min: 0, Max: 4, Mean: 2, InStockPercent: 100 * 2.0 / 3,
+							FirstInStock: at(20), LastInStock: at(40), MaxUnits: 9, ShippingSamples: 1, ShippingPercent: 100 * 1.0 / 3, FirstShipping: at(0),
+						},
+						{Start: at(60), Samples: 1, InStockSamples: 1, Min: 1, Max: 1, Mean: 1, InStockPercent: 100, FirstInStock: at(60), LastInStock: at(60), MaxUnits: 1},
+					},
+				},
+			},
+		},
+		"samples are added to the existing bucket": {
+			rollups: &Rollups{Products: []ProductRollup{
+				{ProductName: "formula", Buckets: []RollupBucket{{Start: at(0), Samples: 1, Min: 0, Max: 0}}},
+			}},
+			stat: HistoricalStat{ProductName: "formula", Data: []HistoricalData{{Time: at(30), Count: 2}}},
+			expected: []ProductRollup{
+				{
+					ProductName: "formula",
+					Buckets: []RollupBucket{
+						{Start: at(0), Samples: 2, InStockSamples: 1, Min: 0, Max: 2, Mean: 1, InStockPercent: 50, FirstInStock: at(30), LastInStock: at(30)},
+					},
+				},
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			addToRollups(tt.rollups, tt.stat, time.Hour)
+			if !reflect.DeepEqual(tt.expected, tt.rollups.Products) {
+				t.Error(spew.Printf("%v\n%v", tt.expected, tt.rollups.Products))
+			}
+			if last := tt.stat.Data[len(tt.stat.Data)-1].Time; tt.rollups.LastUpdatedAt != last {
+				t.Errorf("wanted last updated %d, got %d", last, tt.rollups.LastUpdatedAt)
+			}
+		})
+	}
+}
+
+func TestPruneRollups(t *testing.T) {
+	now := time.Date(2022, 6, 10, 0, 0, 0, 0, time.UTC)
+	level := RollupLevel{Resolution: 24 * time.Hour, Retention: 7 * 24 * time.Hour}
+	daysAgo := func(d int) int64 { return now.Add(time.Duration(-d) * 24 * time.Hour).Unix() }
+	rollups := &Rollups{Products: []ProductRollup{
+		{ProductName: "old formula", Buckets: []RollupBucket{{Start: daysAgo(9)}}},
+		{ProductName: "formula", Buckets: []RollupBucket{{Start: daysAgo(8)}, {Start: daysAgo(7)}, {Start: daysAgo(1)}}},
+	}}
+	expected := []ProductRollup{
+		{ProductName: "formula", Buckets: []RollupBucket{{Start: daysAgo(7)}, {Start: daysAgo(1)}}},
+	}
+
+	pruneRollups(rollups, now, level)
+
+	if !reflect.DeepEqual(expected, rollups.Products) {
+		t.Error(spew.Printf("%v\n%v", expected, rollups.Products))
+	}
+}
+
+func TestUpdateRollups(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	objects := map[string][]byte{
+		"history/2022-06-01.json": mustMarshal(t, HistoricalStats{History: []HistoricalStat{
+			{ProductName: "formula", Data: []HistoricalData{{Time: now.Add(-time.Hour).Unix(), Count: 1}, {Time: now.Unix(), Count: 3}}},
+		}}),
+	}
+	index := &StatsIndex{Partitions: []PartitionRef{
+		{Key: "history/2022-06-01.json", Start: now.Add(-time.Hour).Unix(), End: now.Unix()},
+	}}
+	r := testRun(NewMemoryStatsStore(objects), now)
+
+	// a second update must not count the same samples again
+	for i := 0; i < 2; i++ {
+		if err := r.updateRollups(context.Background(), index, rollupLevels, now.Unix()); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	var daily Rollups
+	if err := json.Unmarshal(objects[schema.DailyRollupKey], &daily); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(daily.Products) != 1 || len(daily.Products[0].Buckets) != 1 {
+		t.Fatal(spew.Sprintf("unexpected rollups: %v", daily))
+	}
+	if b := daily.Products[0].Buckets[0]; b.Samples != 2 || b.Mean != 2 || b.Max != 3 {
+		t.Error(spew.Sprintf("unexpected bucket: %v", b))
+	}
+	var hourly Rollups
+	if err := json.Unmarshal(objects[schema.HourlyRollupKey], &hourly); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(hourly.Products) != 1 || len(hourly.Products[0].Buckets) != 2 {
+		t.Error(spew.Sprintf("unexpected rollups: %v", hourly))
+	}
+}
+
+func TestUpdateRollups_LateSample(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 30, 0, 0, time.UTC)
+	at := func(m int) int64 { return now.Add(time.Duration(m) * time.Minute).Unix() }
+	objects := map[string][]byte{
+		"history/2022-06-01.json": mustMarshal(t, HistoricalStats{History: []HistoricalStat{
+			{ProductName: "formula", Data: []HistoricalData{{Time: at(-90), Count: 1}, {Time: at(0), Count: 3}}},
+		}}),
+	}
+	index := &StatsIndex{Partitions: []PartitionRef{{Key: "history/2022-06-01.json", Start: at(-90), End: at(0)}}}
+	levels := []RollupLevel{{Key: schema.HourlyRollupKey, Resolution: time.Hour, Retention: 24 * time.Hour}}
+	r := testRun(NewMemoryStatsStore(objects), now)
+	if err := r.updateRollups(context.Background(), index, levels, at(0)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// a run that started before the last one saves its samples after it
+	objects["history/2022-06-01.json"] = mustMarshal(t, HistoricalStats{History: []HistoricalStat{
+		{ProductName: "formula", Data: []HistoricalData{{Time: at(-90), Count: 1}, {Time: at(0), Count: 3}, {Time: at(-10), Count: 5}}},
+	}})
+	if err := r.updateRollups(context.Background(), index, levels, at(-10)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var hourly Rollups
+	if err := json.Unmarshal(objects[schema.HourlyRollupKey], &hourly); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []RollupBucket{
+		{Start: at(-90), Samples: 1, InStockSamples: 1, Min: 1, Max: 1, Mean: 1, InStockPercent: 100, FirstInStock: at(-90), LastInStock: at(-90)},
+		{Start: at(-30), Samples: 2, InStockSamples: 2, Min: 3, Max: 5, Mean: 4, InStockPercent: 100, FirstInStock: at(-10), LastInStock: at(0)},
+	}
+	if len(hourly.Products) != 1 || !reflect.DeepEqual(expected, hourly.Products[0].Buckets) {
+		t.Error(spew.Sprintf("wanted %v, got %v", expected, hourly.Products))
+	}
+	if hourly.LastUpdatedAt != at(0) {
+		t.Errorf("wanted last updated %d, got %d", at(0), hourly.LastUpdatedAt)
+	}
+}
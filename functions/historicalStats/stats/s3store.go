@@ -0,0 +1,127 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"path"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// S3StatsStore keeps objects in an S3 bucket.  Objects are saved with a SHA-256 checksum, which is checked when they
+// are read.
+type S3StatsStore struct {
+	API    S3API
+	Bucket string
+	Logger *log.Logger
+}
+
+func (s S3StatsStore) Get(ctx context.Context, key string) ([]byte, string, error) {
+	out, err := s.API.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:              aws.String(s.Bucket),
+		Key:                 aws.String(key),
+		ChecksumMode:        types.ChecksumModeEnabled,
+		ResponseContentType: aws.String("application/json"),
+	}, withoutChecksumValidation)
+	var ae smithy.APIError
+	if errors.As(err, &ae) {
+		s.Logger.Printf("S3 error: %s", ae)
+		s.Logger.Printf("ae: %#v", ae)
+		if ae.ErrorCode() == s3NoSuchKeyErr {
+			return nil, "", errNotFound
+		}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	defer out.Body.Close()
+	etag := aws.ToString(out.ETag)
+	b, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if expected := aws.ToString(out.ChecksumSHA256); expected != "" && expected != sha256Checksum(b) {
+		return b, etag, errCorrupt
+	}
+	return b, etag, nil
+}
+
+func (s S3StatsStore) Put(ctx context.Context, key string, b []byte, etag string) error {
+	_, err := s.API.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:            aws.String(s.Bucket),
+		Key:               aws.String(key),
+		Body:              bytes.NewReader(b),
+		ContentType:       aws.String(contentType(key)),
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+		ChecksumSHA256:    aws.String(sha256Checksum(b)),
+	}, withCondition(etag))
+	var ae smithy.APIError
+	if errors.As(err, &ae) && (ae.ErrorCode() == s3PreconditionFailedErr || ae.ErrorCode() == s3ConditionalConflictErr) {
+		return errConflict
+	}
+	return err
+}
+
+func (s S3StatsStore) Delete(ctx context.Context, key string) error {
+	_, err := s.API.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// contentType is the Content-Type of the object at key, from its extension.  The stats documents are JSON.
+func contentType(key string) string {
+	switch path.Ext(key) {
+	case ".csv":
+		return "text/csv"
+	case ".parquet":
+		return "application/vnd.apache.parquet"
+	case ".html":
+		return "text/html; charset=utf-8"
+	case ".atom":
+		return "application/atom+xml"
+	default:
+		return "application/json"
+	}
+}
+
+// sha256Checksum is the base64 encoded SHA-256 of b, as S3 expects it.
+func sha256Checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// checksumValidationID is the SDK middleware that checks the checksum of a response as its body is read.
+const checksumValidationID = "AWSChecksum:ValidateOutputPayloadChecksum"
+
+// withoutChecksumValidation leaves checking the checksum of an object to Get.  The error the SDK returns when the
+// checksum does not match has no exported type, so it could only be told apart from a failed read by its message.
+func withoutChecksumValidation(o *s3.Options) {
+	o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+		_, err := stack.Deserialize.Remove(checksumValidationID)
+		return err
+	})
+}
+
+// withCondition adds the If-Match or If-None-Match header to a request.  The SDK version in use does not have these
+// on PutObjectInput, so they are added to the request directly.
+func withCondition(etag string) func(*s3.Options) {
+	return func(o *s3.Options) {
+		if etag == "" {
+			o.APIOptions = append(o.APIOptions, smithyhttp.SetHeaderValue("If-None-Match", "*"))
+		} else {
+			o.APIOptions = append(o.APIOptions, smithyhttp.SetHeaderValue("If-Match", etag))
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"testing"
+	"testing/iotest"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/davecgh/go-spew/spew"
+)
+
+type mockS3PutObjectAPI func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+
+func (m mockS3PutObjectAPI) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+type mockS3GetObjectAPI func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+
+func (m mockS3GetObjectAPI) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+// mockS3API joins separate mocks of each API.
+type mockS3API struct {
+	S3GetObjectAPI
+	S3PutObjectAPI
+	S3DeleteObjectAPI
+}
+
+func TestS3StatsStore_Get(t *testing.T) {
+	body := []byte(`{"history":[]}`)
+	cases := map[string]struct {
+		expected    []byte
+		expectedErr error
+		api         func(t *testing.T) S3GetObjectAPI
+	}{
+		"Successful API returns object": {
+			expected: body,
+			api: func(t *testing.T) S3GetObjectAPI {
+				return mockS3GetObjectAPI(func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+					t.Helper()
+					validateGetObjectParams(t, params)
+					return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(body))}, nil
+				})
+			},
+		},
+		"IO error returns error": {
+			expectedErr: errors.New("Can't read this"),
+			api: func(t *testing.T) S3GetObjectAPI {
+				return mockS3GetObjectAPI(func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+					t.Helper()
+					validateGetObjectParams(t, params)
+					expectedErr := errors.New("Can't read this")
+					return &s3.GetObjectOutput{
+						Body: io.NopCloser(iotest.ErrReader(expectedErr)),
+					}, nil
+				})
+			},
+		},
+		"S3 API error returns error": {
+			expectedErr: errors.New("api error AccessDenied: Access Denied"),
+			api: func(t *testing.T) S3GetObjectAPI {
+				return mockS3GetObjectAPI(func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+					t.Helper()
+					validateGetObjectParams(t, params)
+					return nil, &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}
+				})
+			},
+		},
+		"S3 no such key error is not found": {
+			expectedErr: errNotFound,
+			api: func(t *testing.T) S3GetObjectAPI {
+				return mockS3GetObjectAPI(func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+					t.Helper()
+					validateGetObjectParams(t, params)
+					ae := &smithy.GenericAPIError{
+						Code:    s3NoSuchKeyErr,
+						Message: "Object not found",
+						Fault:   smithy.FaultClient,
+					}
+					return nil, ae
+				})
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			store := S3StatsStore{API: mockS3API{S3GetObjectAPI: tt.api(t)}, Bucket: "test-bucket", Logger: log.Default()}
+
+			actual, _, err := store.Get(context.Background(), "history/2022-06-01.json")
+
+			if err != nil {
+				if tt.expectedErr == nil {
+					t.Fatalf("unexpected error: %s\n", err)
+				} else {
+					if err.Error() != tt.expectedErr.Error() {
+						t.Errorf("wanted error: %s\ngot: %s\n", tt.expectedErr, err)
+					}
+				}
+			}
+			if !bytes.Equal(tt.expected, actual) {
+				t.Errorf("wanted %s, got %s", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestS3StatsStore_Put(t *testing.T) {
+	cases := map[string]struct {
+		expectedErr error
+		api         func(t *testing.T) S3PutObjectAPI
+	}{
+		"No API error returns no error": {
+			api: func(t *testing.T) S3PutObjectAPI {
+				return mockS3PutObjectAPI(func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+					t.Helper()
+					validatePutObjectParams(t, params)
+					return nil, nil
+				})
+			},
+		},
+		"API error returns error": {
+			expectedErr: errors.New("api error 404: Object not found"),
+			api: func(t *testing.T) S3PutObjectAPI {
+				return mockS3PutObjectAPI(func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+					t.Helper()
+					validatePutObjectParams(t, params)
+					ae := &smithy.GenericAPIError{
+						Code:    "404",
+						Message: "Object not found",
+						Fault:   smithy.FaultUnknown,
+					}
+					return nil, ae
+				})
+			},
+		},
+		"Precondition failed is a conflict": {
+			expectedErr: errConflict,
+			api: func(t *testing.T) S3PutObjectAPI {
+				return mockS3PutObjectAPI(func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+					return nil, &smithy.GenericAPIError{Code: s3PreconditionFailedErr}
+				})
+			},
+		},
+		"Conditional request conflict is a conflict": {
+			expectedErr: errConflict,
+			api: func(t *testing.T) S3PutObjectAPI {
+				return mockS3PutObjectAPI(func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+					return nil, &smithy.GenericAPIError{Code: s3ConditionalConflictErr}
+				})
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			store := S3StatsStore{API: mockS3API{S3PutObjectAPI: tt.api(t)}, Bucket: "test-bucket", Logger: log.Default()}
+
+			err := store.Put(context.Background(), "history/2022-06-01.json", []byte("{}"), "")
+
+			if err != nil {
+				if tt.expectedErr == nil {
+					t.Fatalf("unexpected error: %s\n", err)
+				} else {
+					if err.Error() != tt.expectedErr.Error() {
+						t.Errorf("wanted error: %s\ngot: %s\n", tt.expectedErr, err)
+					}
+				}
+			} else if tt.expectedErr != nil {
+				t.Errorf("wanted error: %s", tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestS3StatsStore_GetChecksum(t *testing.T) {
+	body := []byte(`{"history":[]}`)
+	cases := map[string]struct {
+		checksum    *string
+		expectedErr error
+	}{
+		"Matching checksum returns object": {checksum: aws.String(sha256Checksum(body))},
+		"Missing checksum returns object":  {},
+		"Mismatched checksum is corrupt": {
+			checksum:    aws.String(sha256Checksum([]byte("something else"))),
+			expectedErr: errCorrupt,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			api := mockS3GetObjectAPI(func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+				return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(body)), ChecksumSHA256: tt.checksum}, nil
+			})
+			store := S3StatsStore{API: mockS3API{S3GetObjectAPI: api}, Bucket: "bucket", Logger: log.Default()}
+			b, _, err := store.Get(context.Background(), "key")
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("wanted error %v, got %v", tt.expectedErr, err)
+			}
+			if !bytes.Equal(b, body) {
+				t.Errorf("wanted %s, got %s", body, b)
+			}
+		})
+	}
+}
+
+func TestS3StatsStore_GetChecksumValidation(t *testing.T) {
+	var validations []string
+	api := mockS3GetObjectAPI(func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+		var o s3.Options
+		for _, fn := range optFns {
+			fn(&o)
+		}
+		stack := middleware.NewStack("GetObject", smithyhttp.NewStackRequest)
+		validate := middleware.DeserializeMiddlewareFunc(checksumValidationID, func(ctx context.Context, in middleware.DeserializeInput, next middleware.DeserializeHandler) (middleware.DeserializeOutput, middleware.Metadata, error) {
+			return next.HandleDeserialize(ctx, in)
+		})
+		if err := stack.Deserialize.Add(validate, middleware.After); err != nil {
+			return nil, err
+		}
+		for _, fn := range o.APIOptions {
+			if err := fn(stack); err != nil {
+				return nil, err
+			}
+		}
+		validations = stack.Deserialize.List()
+		return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader([]byte("{}")))}, nil
+	})
+	store := S3StatsStore{API: mockS3API{S3GetObjectAPI: api}, Bucket: "bucket", Logger: log.Default()}
+
+	if _, _, err := store.Get(context.Background(), "key"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(validations) != 0 {
+		t.Errorf("expected the checksum to be left to Get, got %v", validations)
+	}
+}
+
+func TestWithCondition(t *testing.T) {
+	cases := map[string]struct {
+		etag     string
+		expected map[string]string
+	}{
+		"ETag is matched": {
+			etag:     `"abc"`,
+			expected: map[string]string{"If-Match": `"abc"`, "If-None-Match": ""},
+		},
+		"Missing object must still be missing": {
+			expected: map[string]string{"If-Match": "", "If-None-Match": "*"},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			header, err := requestHeader(withCondition(tt.etag))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for k, v := range tt.expected {
+				if header.Get(k) != v {
+					t.Errorf("wanted %s: %q, got %q", k, v, header.Get(k))
+				}
+			}
+		})
+	}
+}
+
+func TestSHA256Checksum(t *testing.T) {
+	// echo -n 'hello' | openssl dgst -sha256 -binary | base64
+	if actual := sha256Checksum([]byte("hello")); actual != "LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=" {
+		t.Errorf("unexpected checksum: %s", actual)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	cases := map[string]string{
+		"historical_stats.json":   "application/json",
+		"exports/history.csv":     "text/csv",
+		"exports/history.parquet": "application/vnd.apache.parquet",
+		"index.html":              "text/html; charset=utf-8",
+		"feed.atom":               "application/atom+xml",
+		"no-extension":            "application/json",
+	}
+
+	for key, expected := range cases {
+		t.Run(key, func(t *testing.T) {
+			if actual := contentType(key); actual != expected {
+				t.Errorf("wanted %s, got %s", expected, actual)
+			}
+		})
+	}
+}
+
+// requestHeader runs the API options in optFns against an empty request and returns the headers they set.
+func requestHeader(optFns ...func(*s3.Options)) (http.Header, error) {
+	var o s3.Options
+	for _, fn := range optFns {
+		fn(&o)
+	}
+	stack := middleware.NewStack("requestHeader", smithyhttp.NewStackRequest)
+	for _, fn := range o.APIOptions {
+		if err := fn(stack); err != nil {
+			return nil, err
+		}
+	}
+	var header http.Header
+	h := middleware.DecorateHandler(middleware.HandlerFunc(func(ctx context.Context, in interface{}) (interface{}, middleware.Metadata, error) {
+		header = in.(*smithyhttp.Request).Header
+		return nil, middleware.Metadata{}, nil
+	}), stack)
+	_, _, err := h.Handle(context.Background(), nil)
+	return header, err
+}
+
+func validateGetObjectParams(t testing.TB, params *s3.GetObjectInput) {
+	if params.Bucket == nil || params.Key == nil {
+		t.Log(spew.Printf("bucket: %v\nkey:%v\n", params.Bucket, params.Key))
+		t.Error("params.Bucket and params.Key cannot be nil")
+	}
+}
+
+func validatePutObjectParams(t testing.TB, params *s3.PutObjectInput) {
+	if params.Bucket == nil || params.Key == nil || params.Body == nil {
+		t.Log(spew.Printf("bucket: %v\nkey:%v\nbody: %v\n", params.Bucket, params.Key, params.Body))
+		t.Error("params.Bucket and params.Key and params.Body cannot be nil")
+	}
+	if aws.ToString(params.ContentType) != "application/json" || params.ContentEncoding != nil {
+		t.Errorf("expected JSON content type, got type %v and encoding %v", params.ContentType, params.ContentEncoding)
+	}
+	if params.ChecksumAlgorithm != types.ChecksumAlgorithmSha256 || params.ChecksumSHA256 == nil {
+		t.Error("expected a SHA-256 checksum")
+	}
+}
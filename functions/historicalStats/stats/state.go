@@ -0,0 +1,44 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+// updateState records the products checked in this run in the index's current state.  Products that are not in the
+// run keep their state.
+func updateState(index *StatsIndex, products []schema.Product, now time.Time) {
+	if index.Current == nil {
+		index.Current = map[string]ProductState{}
+	}
+	for _, p := range products {
+		key := p.HistoryKey()
+		state := index.Current[key]
+		state.TCIN, state.Name, state.ProductURL = p.TCIN, p.Name, p.ProductURL
+		state.LastChecked = now.Unix()
+		if p.Failed() {
+			state.Status = schema.StatusFailed
+			state.ConsecutiveFailures++
+			index.Current[key] = state
+			continue
+		}
+		state.Result = p.Result
+		state.ConsecutiveFailures = 0
+		state.Status = schema.StatusOutOfStock
+		// in stock the same way as the history and push notifications, at a store or for shipping
+		if p.Result.Available() {
+			state.Status = schema.StatusInStock
+			state.LastInStock = now.Unix()
+		}
+		index.Current[key] = state
+	}
+}
+
+// stateFromProducts builds the current state from the products of the last run, as kept in indexes written before
+// there was a current state.
+func stateFromProducts(products []schema.Product, lastUpdated int64) map[string]ProductState {
+	index := &StatsIndex{}
+	updateState(index, products, time.Unix(lastUpdated, 0))
+	return index.Current
+}
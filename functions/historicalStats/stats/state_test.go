@@ -0,0 +1,94 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/davecgh/go-spew/spew"
+)
+
+func TestUpdateState(t *testing.T) {
+	earlier := time.Date(2022, 6, 1, 11, 0, 0, 0, time.UTC)
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	inStock := schema.ProductResult{Pickup: schema.PickupResult{TotalStores: 2}}
+	shippingOnly := schema.ProductResult{Shipping: schema.ShippingResult{IsAvailable: true, AvailableToPromise: 5}}
+	checked := func(name, tcin string, result schema.ProductResult) schema.Product {
+		return schema.Product{ProductQuery: schema.ProductQuery{Name: name, TCIN: tcin, ProductURL: "https://example.com/" + tcin}, Result: result}
+	}
+	failed := func(name, tcin string) schema.Product {
+		p := checked(name, tcin, schema.ProductResult{})
+		p.Error = &schema.CheckError{Error: "Lambda.Unknown", Cause: "timed out"}
+		return p
+	}
+	cases := map[string]struct {
+		current  map[string]ProductState
+		products []schema.Product
+		expected map[string]ProductState
+	}{
+		"New products are added": {
+			products: []schema.Product{checked("formula", "123", inStock), checked("no tcin", "", schema.ProductResult{})},
+			expected: map[string]ProductState{
+				"123": {
+					TCIN: "123", Name: "formula", ProductURL: "https://example.com/123", LastChecked: now.Unix(), LastInStock: now.Unix(),
+					Status: schema.StatusInStock, Result: inStock,
+				},
+				"no tcin": {Name: "no tcin", ProductURL: "https://example.com/", LastChecked: now.Unix(), Status: schema.StatusOutOfStock},
+			},
+		},
+		"Removed products are kept": {
+			current: map[string]ProductState{
+				"456": {TCIN: "456", Name: "removed", LastChecked: earlier.Unix(), Status: schema.StatusOutOfStock},
+			},
+			products: []schema.Product{checked("formula", "123", schema.ProductResult{})},
+			expected: map[string]ProductState{
+				"123": {TCIN: "123", Name: "formula", ProductURL: "https://example.com/123", LastChecked: now.Unix(), Status: schema.StatusOutOfStock},
+				"456": {TCIN: "456", Name: "removed", LastChecked: earlier.Unix(), Status: schema.StatusOutOfStock},
+			},
+		},
+		"Failures are counted and keep the last result": {
+			current: map[string]ProductState{
+				"123": {TCIN: "123", Name: "formula", LastChecked: earlier.Unix(), LastInStock: earlier.Unix(), Status: schema.StatusFailed, Result: inStock, ConsecutiveFailures: 1},
+			},
+			products: []schema.Product{failed("formula", "123")},
+			expected: map[string]ProductState{
+				"123": {
+					TCIN: "123", Name: "formula", ProductURL: "https://example.com/123", LastChecked: now.Unix(), LastInStock: earlier.Unix(),
+					Status: schema.StatusFailed, Result: inStock, ConsecutiveFailures: 2,
+				},
+			},
+		},
+		"Shipping only is in stock": {
+			products: []schema.Product{checked("formula", "123", shippingOnly)},
+			expected: map[string]ProductState{
+				"123": {
+					TCIN: "123", Name: "formula", ProductURL: "https://example.com/123", LastChecked: now.Unix(), LastInStock: now.Unix(),
+					Status: schema.StatusInStock, Result: shippingOnly,
+				},
+			},
+		},
+		"A successful check resets the failures": {
+			current: map[string]ProductState{
+				"123": {TCIN: "123", Name: "formula", LastChecked: earlier.Unix(), LastInStock: earlier.Unix(), Status: schema.StatusFailed, Result: inStock, ConsecutiveFailures: 3},
+			},
+			products: []schema.Product{checked("formula", "123", schema.ProductResult{})},
+			expected: map[string]ProductState{
+				"123": {
+					TCIN: "123", Name: "formula", ProductURL: "https://example.com/123", LastChecked: now.Unix(), LastInStock: earlier.Unix(),
+					Status: schema.StatusOutOfStock,
+				},
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			index := &StatsIndex{Current: tt.current}
+			updateState(index, tt.products, now)
+			if !reflect.DeepEqual(tt.expected, index.Current) {
+				t.Error(spew.Printf("%v\n%v", tt.expected, index.Current))
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+// readJSON decodes the object at key into v, upgrading it with upgrades and tcins, and returns its ETag.  Callers of
+// documents that may be upgraded write them back in the same run, conditional on the ETag.  An object that fails its
+// checksum or cannot be decoded is copied to the quarantine prefix and reported as errNotFound, along with its ETag so
+// it can be replaced.
+func (r *run) readJSON(ctx context.Context, key string, v interface{}, upgrades map[int]documentUpgrade, tcins map[string]string) (string, error) {
+	b, etag, err := r.store.Get(ctx, key)
+	if err == nil {
+		if _, decodeErr := decodeDocument(b, v, upgrades, tcins); errors.Is(decodeErr, errNewerVersion) {
+			return "", fmt.Errorf("%s: %w", key, decodeErr)
+		} else if decodeErr != nil {
+			r.logger.Printf("unable to decode %s: %s\n", key, decodeErr)
+			err = errCorrupt
+		}
+	}
+	if !errors.Is(err, errCorrupt) {
+		return etag, err
+	}
+	backup := quarantineKey(key, r.now, b)
+	r.logger.Printf("%s is corrupt, moving it to %s\n", key, backup)
+	// the key is unique to the content, so a conflict means the same object is already quarantined
+	if err := r.store.Put(ctx, backup, b, ""); err != nil && !errors.Is(err, errConflict) {
+		return "", err
+	}
+	return etag, errNotFound
+}
+
+// replaceObject writes b to key, replacing whatever is there.  It is for objects that are rebuilt from scratch every
+// run, so when another run replaces the object first that one is kept.
+func (r *run) replaceObject(ctx context.Context, key string, b []byte) error {
+	// only the ETag is needed, a corrupt object is replaced like any other
+	_, etag, err := r.store.Get(ctx, key)
+	if err != nil && !errors.Is(err, errNotFound) && !errors.Is(err, errCorrupt) {
+		return err
+	}
+	err = r.store.Put(ctx, key, b, etag)
+	if errors.Is(err, errConflict) {
+		r.logger.Printf("%s was replaced by another run, keeping it\n", key)
+		return nil
+	}
+	return err
+}
+
+// quarantineKey is where a corrupt object b is kept for inspection.  The key ends with the time and the ETag of b, so
+// different objects quarantined in the same second are all kept.
+func quarantineKey(key string, t time.Time, b []byte) string {
+	return fmt.Sprintf("%s%s.%d.%s", quarantinePrefix, key, t.Unix(), contentETag(b))
+}
+
+// getCurrentStatsOrEmpty reads the partition at key, or starts a new one if it does not exist yet or is corrupt.
+func (r *run) getCurrentStatsOrEmpty(ctx context.Context, key string, tcins map[string]string) (*HistoricalStats, string, error) {
+	var hs HistoricalStats
+	etag, err := r.readJSON(ctx, key, &hs, statsUpgrades, tcins)
+	if errors.Is(err, errNotFound) {
+		return &HistoricalStats{Version: schema.StatsVersion, CreatedAt: r.now.Unix()}, etag, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &hs, etag, nil
+}
+
+// appendSamples adds a sample of each product to the partition at key, upgrading it with tcins.  If another run
+// changes the partition before it is saved, the partition is read again and the samples are added to that, up to
+// maxWriteAttempts times.
+func (r *run) appendSamples(ctx context.Context, key string, products []schema.Product, tcins map[string]string) (*HistoricalStats, error) {
+	for attempt := 1; ; attempt++ {
+		stats, etag, err := r.getCurrentStatsOrEmpty(ctx, key, tcins)
+		if err != nil {
+			return nil, err
+		}
+		for _, product := range products {
+			// a failed check says nothing about availability
+			if !product.Failed() {
+				r.addHistoricalData(stats, product)
+			}
+		}
+		err = r.saveStats(ctx, key, stats, etag)
+		if !errors.Is(err, errConflict) || attempt == maxWriteAttempts {
+			return stats, err
+		}
+		r.logger.Printf("%s was changed by another run, retrying\n", key)
+	}
+}
+
+// sampleProduct records the in-store and shipping availability of the product at the time of this run, including
+// the quantity at each store.
+func (r *run) sampleProduct(product schema.Product) HistoricalData {
+	units := 0
+	var stores schema.StoreSamples
+	for _, store := range product.Result.Pickup.Stores {
+		units += store.AvailableToPromise
+		stores = append(stores, schema.StoreSample{StoreID: store.StoreID, Quantity: store.AvailableToPromise})
+	}
+	return HistoricalData{
+		Time:              r.now.Unix(),
+		Count:             product.Result.Pickup.TotalStores,
+		Units:             units,
+		ShippingAvailable: product.Result.Shipping.IsAvailable,
+		ShippingQuantity:  product.Result.Shipping.AvailableToPromise,
+		Stores:            stores,
+	}
+}
+
+func (r *run) addHistoricalData(stats *HistoricalStats, product schema.Product) {
+	data := r.sampleProduct(product)
+	statIdx := -1
+	for i, existingStat := range stats.History {
+		if existingStat.Key() == product.HistoryKey() {
+			statIdx = i
+			break
+		}
+	}
+	if statIdx == -1 {
+		newStat := HistoricalStat{TCIN: product.TCIN, ProductName: product.Name, Data: []HistoricalData{data}}
+		stats.History = append(stats.History, newStat)
+	} else {
+		stats.History[statIdx].ProductName = product.Name
+		stats.History[statIdx].Data = append(stats.History[statIdx].Data, data)
+	}
+	stats.LastUpdatedAt = r.now.Unix()
+}
+
+// saveStats writes the partition to key if it has not changed since it was read with etag.
+func (r *run) saveStats(ctx context.Context, key string, stats *HistoricalStats, etag string) error {
+	b, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	err = r.store.Put(ctx, key, b, etag)
+	if err == nil {
+		r.logger.Printf("Successfully wrote stat to %s: %s\n", key, b)
+	}
+	return err
+}
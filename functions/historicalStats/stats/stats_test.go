@@ -0,0 +1,452 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// rollupLevels are the default rollups.
+var rollupLevels = []RollupLevel{
+	{Key: schema.HourlyRollupKey, Resolution: time.Hour, Retention: defaultHourlyRollupRetention},
+	{Key: schema.DailyRollupKey, Resolution: 24 * time.Hour, Retention: defaultDailyRollupRetention},
+}
+
+// testHandler is a Handler with the default configuration, which keeps its stats in store.
+func testHandler(store StatsStore) *Handler {
+	return &Handler{logger: log.Default(), store: store, retention: defaultRetention, rollups: rollupLevels}
+}
+
+// testRun is a run of testHandler at now.
+func testRun(store StatsStore, now time.Time) *run {
+	return &run{Handler: testHandler(store), now: now}
+}
+
+func TestGetCurrentStatsOrEmpty(t *testing.T) {
+	now := time.Now()
+	nowUnix := now.Unix()
+	key := "history/2022-06-01.json"
+	cases := map[string]struct {
+		expected    *HistoricalStats
+		expectedErr error
+		objects     func(t *testing.T) map[string][]byte
+	}{
+		"Existing stats are returned": {
+			expected: &HistoricalStats{
+				Version:       schema.StatsVersion,
+				CreatedAt:     nowUnix,
+				LastUpdatedAt: nowUnix,
+				History:       []HistoricalStat{{TCIN: "123", ProductName: "formula", Data: []HistoricalData{{Time: nowUnix, Count: 1}}}},
+			},
+			objects: func(t *testing.T) map[string][]byte {
+				return map[string][]byte{key: mustMarshal(t, HistoricalStats{
+					Version:       schema.StatsVersion,
+					CreatedAt:     nowUnix,
+					LastUpdatedAt: nowUnix,
+					History:       []HistoricalStat{{TCIN: "123", ProductName: "formula", Data: []HistoricalData{{Time: nowUnix, Count: 1}}}},
+				})}
+			},
+		},
+		"Missing stats returns empty stats": {
+			expected: &HistoricalStats{Version: schema.StatsVersion, CreatedAt: nowUnix},
+			objects:  func(t *testing.T) map[string][]byte { return map[string][]byte{} },
+		},
+		"Stats from a newer version returns error": {
+			expectedErr: errNewerVersion,
+			objects: func(t *testing.T) map[string][]byte {
+				return map[string][]byte{key: readFixture(t, "stats_v3.json")}
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := testRun(NewMemoryStatsStore(tt.objects(t)), now)
+
+			actual, _, err := r.getCurrentStatsOrEmpty(context.Background(), key, nil)
+
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("wanted error %v, got %v", tt.expectedErr, err)
+			}
+			if tt.expected != nil {
+				if !reflect.DeepEqual(tt.expected, actual) {
+					t.Error(spew.Printf("%v\n%v", tt.expected, actual))
+				}
+			}
+		})
+	}
+}
+
+func TestSaveStats(t *testing.T) {
+	key := "history/2022-06-01.json"
+	stats := &HistoricalStats{
+		CreatedAt:     time.Now().Unix(),
+		LastUpdatedAt: time.Now().Unix(),
+		History:       []HistoricalStat{{ProductName: "formula"}},
+	}
+	cases := map[string]struct {
+		objects     map[string][]byte
+		expectedErr error
+	}{
+		"New stats are saved": {
+			objects: map[string][]byte{},
+		},
+		"Stats saved by another run are a conflict": {
+			objects:     map[string][]byte{key: []byte("{}")},
+			expectedErr: errConflict,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := testRun(NewMemoryStatsStore(tt.objects), time.Now()).saveStats(context.Background(), key, stats, "")
+
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("wanted error %v, got %v", tt.expectedErr, err)
+			}
+			if tt.expectedErr == nil && !bytes.Equal(tt.objects[key], mustMarshal(t, stats)) {
+				t.Errorf("expected the stats to be saved, got %s", tt.objects[key])
+			}
+		})
+	}
+}
+
+func TestAddHistoricalData(t *testing.T) {
+	now := time.Now()
+	r := testRun(NewMemoryStatsStore(nil), now)
+	cases := map[string]struct {
+		stats   *HistoricalStats
+		product schema.Product
+		history []HistoricalStat
+	}{
+		"new product is added": {
+			history: []HistoricalStat{
+				{
+					ProductName: "other formula",
+				},
+				{
+					ProductName: "formula",
+					Data: []HistoricalData{
+						{
+							Time:  now.Unix(),
+							Count: 2,
+						},
+					},
+				},
+			},
+			product: schema.Product{
+				ProductQuery: schema.ProductQuery{
+					Name: "formula",
+				},
+				Result: schema.ProductResult{
+					Pickup: schema.PickupResult{
+						TotalStores: 2,
+					},
+				},
+			},
+			stats: &HistoricalStats{
+				History: []HistoricalStat{
+					{
+						ProductName: "other formula",
+					},
+				},
+			},
+		},
+		"units, stores and shipping are recorded": {
+			history: []HistoricalStat{
+				{
+					ProductName: "formula",
+					Data: []HistoricalData{
+						{
+							Time:              now.Unix(),
+							Count:             2,
+							Units:             5,
+							ShippingAvailable: true,
+							ShippingQuantity:  10,
+							Stores:            schema.StoreSamples{{StoreID: "1234", Quantity: 2}, {StoreID: "5678", Quantity: 3}},
+						},
+					},
+				},
+			},
+			product: schema.Product{
+				ProductQuery: schema.ProductQuery{
+					Name: "formula",
+				},
+				Result: schema.ProductResult{
+					Pickup: schema.PickupResult{
+						Stores:      []schema.StoreResult{{StoreID: "1234", AvailableToPromise: 2}, {StoreID: "5678", AvailableToPromise: 3}},
+						TotalStores: 2,
+					},
+					Shipping: schema.ShippingResult{
+						AvailableToPromise: 10,
+						IsAvailable:        true,
+					},
+				},
+			},
+			stats: &HistoricalStats{},
+		},
+		"renamed product keeps its history": {
+			history: []HistoricalStat{
+				{
+					TCIN:        "123",
+					ProductName: "new formula",
+					Data:        []HistoricalData{{Time: now.Add(-1 * time.Hour).Unix(), Count: 4}, {Time: now.Unix(), Count: 2}},
+				},
+				{
+					TCIN:        "456",
+					ProductName: "formula",
+				},
+			},
+			product: schema.Product{
+				ProductQuery: schema.ProductQuery{Name: "new formula", TCIN: "123"},
+				Result:       schema.ProductResult{Pickup: schema.PickupResult{TotalStores: 2}},
+			},
+			stats: &HistoricalStats{
+				History: []HistoricalStat{
+					{
+						TCIN:        "123",
+						ProductName: "formula",
+						Data:        []HistoricalData{{Time: now.Add(-1 * time.Hour).Unix(), Count: 4}},
+					},
+					{
+						TCIN:        "456",
+						ProductName: "formula",
+					},
+				},
+			},
+		},
+		"existing product is updated": {
+			history: []HistoricalStat{
+				{
+					ProductName: "formula",
+					Data: []HistoricalData{
+						{
+							Time:  now.Add(-1 * time.Hour).Unix(),
+							Count: 4,
+						},
+						{
+							Time:  now.Unix(),
+							Count: 2,
+						},
+					},
+				},
+				{
+					ProductName: "other formula",
+				},
+			},
+			product: schema.Product{
+				ProductQuery: schema.ProductQuery{
+					Name: "formula",
+				},
+				Result: schema.ProductResult{
+					Pickup: schema.PickupResult{
+						TotalStores: 2,
+					},
+				},
+			},
+			stats: &HistoricalStats{
+				History: []HistoricalStat{
+					{
+						ProductName: "formula",
+						Data: []HistoricalData{
+							{
+								Time:  now.Add(-1 * time.Hour).Unix(),
+								Count: 4,
+							},
+						},
+					},
+					{
+						ProductName: "other formula",
+					},
+				},
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			r.addHistoricalData(tt.stats, tt.product)
+			if len(tt.stats.History) != len(tt.history) {
+				t.Fatalf("history was not updated.  Got %d wanted %d", len(tt.stats.History), len(tt.history))
+			}
+			for i, h := range tt.stats.History {
+				if !reflect.DeepEqual(h, tt.history[i]) {
+					t.Error(spew.Printf("%#v\n%#v\n", h, tt.history[i]))
+				}
+			}
+		})
+	}
+}
+
+// racingStore is a MemoryStatsStore where another run writes just before each of the first races writes of this one.
+type racingStore struct {
+	*MemoryStatsStore
+	races int
+	race  func(objects map[string][]byte)
+}
+
+func (r *racingStore) Put(ctx context.Context, key string, b []byte, etag string) error {
+	if r.races > 0 {
+		r.races--
+		r.race(r.objects)
+	}
+	return r.MemoryStatsStore.Put(ctx, key, b, etag)
+}
+
+func TestAppendSamples_Conflict(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	key := schema.PartitionKey(now)
+	other := HistoricalStats{History: []HistoricalStat{{TCIN: "456", ProductName: "other formula", Data: []HistoricalData{{Time: 1}}}}}
+	products := []schema.Product{{ProductQuery: schema.ProductQuery{Name: "formula", TCIN: "123"}}}
+	cases := map[string]struct {
+		races       int
+		expectedErr error
+	}{
+		"Samples from both runs are kept": {races: 1},
+		"Gives up after the last attempt": {races: maxWriteAttempts, expectedErr: errConflict},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			store := &racingStore{MemoryStatsStore: NewMemoryStatsStore(nil), races: tt.races, race: func(objects map[string][]byte) {
+				other.LastUpdatedAt++
+				objects[key] = mustMarshal(t, other)
+			}}
+
+			_, err := testRun(store, now).appendSamples(context.Background(), key, products, nil)
+
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("wanted error %v, got %v", tt.expectedErr, err)
+			}
+			if tt.expectedErr != nil {
+				return
+			}
+			var part HistoricalStats
+			if err := json.Unmarshal(store.objects[key], &part); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(part.History) != 2 {
+				t.Error(spew.Sprintf("expected samples from both runs: %v", part))
+			}
+		})
+	}
+}
+
+func TestAppendSamples_Failed(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	key := schema.PartitionKey(now)
+	products := []schema.Product{
+		{ProductQuery: schema.ProductQuery{Name: "formula", TCIN: "123"}},
+		{ProductQuery: schema.ProductQuery{Name: "failed formula", TCIN: "456"}, Error: &schema.CheckError{Error: "Lambda.Unknown"}},
+	}
+
+	stats, err := testRun(NewMemoryStatsStore(nil), now).appendSamples(context.Background(), key, products, nil)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(stats.History) != 1 || stats.History[0].TCIN != "123" {
+		t.Error(spew.Sprintf("expected no sample for the failed check: %v", stats))
+	}
+}
+
+func TestGetCurrentStatsOrEmpty_Quarantine(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	key := schema.PartitionKey(now)
+	corrupt := []byte(`{"history":[{"tcin":`)
+	objects := map[string][]byte{key: corrupt}
+
+	stats, etag, err := testRun(NewMemoryStatsStore(objects), now).getCurrentStatsOrEmpty(context.Background(), key, nil)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(stats.History) != 0 {
+		t.Error(spew.Sprintf("expected empty stats, got %v", stats))
+	}
+	if etag != contentETag(corrupt) {
+		t.Errorf("expected the etag of the corrupt object so it can be replaced, got %q", etag)
+	}
+	if !bytes.Equal(objects[quarantineKey(key, now, corrupt)], corrupt) {
+		t.Error("expected the corrupt object to be quarantined")
+	}
+}
+
+func TestReadJSON_QuarantineConflict(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	key := schema.PartitionKey(now)
+	corrupt := []byte(`{"history":[{"tcin":`)
+	cases := map[string]struct {
+		quarantined []byte
+	}{
+		"Another object quarantined in the same second is kept": {quarantined: []byte(`{"history":`)},
+		"The same object quarantined again":                     {quarantined: corrupt},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			earlier := quarantineKey(key, now, tt.quarantined)
+			objects := map[string][]byte{key: corrupt, earlier: tt.quarantined}
+
+			_, err := testRun(NewMemoryStatsStore(objects), now).readJSON(context.Background(), key, &HistoricalStats{}, statsUpgrades, nil)
+
+			if !errors.Is(err, errNotFound) {
+				t.Fatalf("expected the corrupt object to be reported as not found, got %v", err)
+			}
+			if !bytes.Equal(objects[quarantineKey(key, now, corrupt)], corrupt) {
+				t.Error("expected the corrupt object to be quarantined")
+			}
+			if !bytes.Equal(objects[earlier], tt.quarantined) {
+				t.Error("expected the object quarantined earlier to be kept")
+			}
+		})
+	}
+}
+
+func TestStoreSamples_JSON(t *testing.T) {
+	cases := map[string]struct {
+		encoded     string
+		expected    HistoricalData
+		expectedErr bool
+	}{
+		"Stores are a compact string": {
+			encoded:  `{"time":1,"count":2,"units":4,"shipping_available":false,"shipping_quantity":0,"stores":"1234:3,5678:1"}`,
+			expected: HistoricalData{Time: 1, Count: 2, Units: 4, Stores: schema.StoreSamples{{StoreID: "1234", Quantity: 3}, {StoreID: "5678", Quantity: 1}}},
+		},
+		"No stores are left out": {
+			encoded:  `{"time":1,"count":0,"units":0,"shipping_available":false,"shipping_quantity":0}`,
+			expected: HistoricalData{Time: 1},
+		},
+		"Malformed stores are an error": {
+			encoded:     `{"time":1,"stores":"1234"}`,
+			expectedErr: true,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			var actual HistoricalData
+			err := json.Unmarshal([]byte(tt.encoded), &actual)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("wanted error %t, got %v", tt.expectedErr, err)
+			}
+			if tt.expectedErr {
+				return
+			}
+			if !reflect.DeepEqual(tt.expected, actual) {
+				t.Error(spew.Printf("%v\n%v", tt.expected, actual))
+			}
+			if b := mustMarshal(t, actual); string(b) != tt.encoded {
+				t.Errorf("wanted %s, got %s", tt.encoded, b)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package stats
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/akijowski/target-tracker/internal/awsclient"
+)
+
+const (
+	storeEnv    = "STATS_STORE"
+	storeDirEnv = "STATS_DIR"
+	s3Store     = "s3"
+	dirStore    = "dir"
+	memoryStore = "memory"
+)
+
+var (
+	// errNotFound is returned by StatsStore.Get when the key does not exist.
+	errNotFound = errors.New("object not found")
+	// errConflict is returned by StatsStore.Put when the object was changed since it was read.
+	errConflict = errors.New("object changed since it was read")
+	// errCorrupt is returned by StatsStore.Get when the object does not match its checksum.
+	errCorrupt = errors.New("object does not match its checksum")
+)
+
+// StatsStore is where the stats documents are kept, by key.  Writes are conditional on the ETag returned when the
+// object was read, so that overlapping runs do not lose each other's changes.
+type StatsStore interface {
+	// Get returns the object at key and its ETag.  A missing object returns errNotFound, and an object that does not
+	// match its checksum returns its content with errCorrupt.
+	Get(ctx context.Context, key string) ([]byte, string, error)
+	// Put writes the object at key only if it has not changed since it was read with etag.  An empty etag means the
+	// object was not found, and it is only written if it still does not exist.  Otherwise it returns errConflict.
+	Put(ctx context.Context, key string, b []byte, etag string) error
+	// Delete removes the object at key, if it exists.
+	Delete(ctx context.Context, key string) error
+}
+
+// DirStatsStore keeps objects as files under a local directory, with the key as the path.  The ETag is the hash of
+// the content.  Conditions are checked before each write but are not atomic, so it is meant for a single run at a time.
+type DirStatsStore string
+
+func (d DirStatsStore) Get(ctx context.Context, key string) ([]byte, string, error) {
+	b, err := os.ReadFile(d.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", errNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return b, contentETag(b), nil
+}
+
+func (d DirStatsStore) Put(ctx context.Context, key string, b []byte, etag string) error {
+	existing, err := os.ReadFile(d.path(key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if !conditionHolds(existing, err == nil, etag) {
+		return errConflict
+	}
+	if err := os.MkdirAll(filepath.Dir(d.path(key)), 0o755); err != nil {
+		return err
+	}
+	// write to a temporary file first so a failed write does not leave a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(d.path(key)), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), d.path(key))
+}
+
+func (d DirStatsStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(d.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (d DirStatsStore) path(key string) string {
+	return filepath.Join(string(d), filepath.FromSlash(key))
+}
+
+// MemoryStatsStore keeps objects in a map, keyed by object key.  The ETag is the hash of the content.  Nothing is
+// kept between invocations, so it is meant for trying out the function and for tests.  It is safe for concurrent use,
+// so the functions run in one process can share it.  Create it with NewMemoryStatsStore.
+type MemoryStatsStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// NewMemoryStatsStore keeps objects, which may be nil, in memory.  The store takes ownership of the map.
+func NewMemoryStatsStore(objects map[string][]byte) *MemoryStatsStore {
+	if objects == nil {
+		objects = map[string][]byte{}
+	}
+	return &MemoryStatsStore{objects: objects}
+}
+
+func (m *MemoryStatsStore) Get(ctx context.Context, key string) ([]byte, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.objects[key]
+	if !ok {
+		return nil, "", errNotFound
+	}
+	return b, contentETag(b), nil
+}
+
+func (m *MemoryStatsStore) Put(ctx context.Context, key string, b []byte, etag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing, exists := m.objects[key]
+	if !conditionHolds(existing, exists, etag) {
+		return errConflict
+	}
+	m.objects[key] = b
+	return nil
+}
+
+func (m *MemoryStatsStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+// conditionHolds reports whether an object may be written over existing, given the etag it was read with.
+func conditionHolds(existing []byte, exists bool, etag string) bool {
+	if etag == "" {
+		return !exists
+	}
+	return exists && etag == contentETag(existing)
+}
+
+// contentETag is the ETag of an object in the local stores, the hex encoded SHA-256 of its content.
+func contentETag(b []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(b))
+}
+
+// configureStore opens the StatsStore named by the StoreKind of cfg, logging to l.
+func configureStore(l *log.Logger, cfg Config) (StatsStore, error) {
+	switch cfg.StoreKind {
+	case "", s3Store:
+		l.Printf("found bucket name: %s\n", cfg.Bucket)
+		client, err := awsclient.S3(context.Background(), l)
+		if err != nil {
+			return nil, err
+		}
+		return S3StatsStore{API: client, Bucket: cfg.Bucket, Logger: l}, nil
+	case dirStore:
+		if cfg.Dir == "" {
+			return nil, fmt.Errorf("%s must be set when %s is %q", storeDirEnv, storeEnv, dirStore)
+		}
+		l.Printf("Stats directory found: %s\n", cfg.Dir)
+		return DirStatsStore(cfg.Dir), nil
+	case memoryStore:
+		l.Println("keeping stats in memory, nothing will be saved")
+		return NewMemoryStatsStore(nil), nil
+	default:
+		return nil, fmt.Errorf("unknown %s %q", storeEnv, cfg.StoreKind)
+	}
+}
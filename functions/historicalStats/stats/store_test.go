@@ -0,0 +1,172 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocalStatsStores(t *testing.T) {
+	cases := map[string]struct {
+		store func(t *testing.T) StatsStore
+	}{
+		"Directory store": {
+			store: func(t *testing.T) StatsStore { return DirStatsStore(t.TempDir()) },
+		},
+		"Memory store": {
+			store: func(t *testing.T) StatsStore { return NewMemoryStatsStore(nil) },
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := tt.store(t)
+			key := "history/2022-06-01.json"
+
+			if _, _, err := store.Get(ctx, key); !errors.Is(err, errNotFound) {
+				t.Fatalf("wanted %v for a missing object, got %v", errNotFound, err)
+			}
+			if err := store.Put(ctx, key, []byte("first"), ""); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := store.Put(ctx, key, []byte("second"), ""); !errors.Is(err, errConflict) {
+				t.Errorf("wanted %v creating an object that exists, got %v", errConflict, err)
+			}
+			b, etag, err := store.Get(ctx, key)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !bytes.Equal(b, []byte("first")) {
+				t.Errorf("wanted first, got %s", b)
+			}
+			if err := store.Put(ctx, key, []byte("second"), etag); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := store.Put(ctx, key, []byte("third"), etag); !errors.Is(err, errConflict) {
+				t.Errorf("wanted %v writing with a stale etag, got %v", errConflict, err)
+			}
+			if err := store.Delete(ctx, key); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := store.Delete(ctx, key); err != nil {
+				t.Errorf("unexpected error deleting a missing object: %s", err)
+			}
+			if _, _, err := store.Get(ctx, key); !errors.Is(err, errNotFound) {
+				t.Errorf("wanted %v after delete, got %v", errNotFound, err)
+			}
+		})
+	}
+}
+
+func TestMemoryStatsStore_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStatsStore(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("history/%d.json", i)
+			if err := store.Put(ctx, key, []byte(key), ""); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			store.Get(ctx, key)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("history/%d.json", i)
+		if b, _, err := store.Get(ctx, key); err != nil || string(b) != key {
+			t.Errorf("wanted %s, got %q and %v", key, b, err)
+		}
+	}
+}
+
+func TestConfigureStore(t *testing.T) {
+	cases := map[string]struct {
+		cfg         Config
+		expected    string
+		expectedErr bool
+	}{
+		"Directory store": {
+			cfg:      Config{StoreKind: dirStore, Dir: "/tmp/stats"},
+			expected: "stats.DirStatsStore",
+		},
+		"Directory store needs a directory": {
+			cfg:         Config{StoreKind: dirStore},
+			expectedErr: true,
+		},
+		"Memory store": {
+			cfg:      Config{StoreKind: memoryStore},
+			expected: "*stats.MemoryStatsStore",
+		},
+		"Unknown store is an error": {
+			cfg:         Config{StoreKind: "floppy"},
+			expectedErr: true,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := configureStore(log.Default(), tt.cfg)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("wanted error %t, got %v", tt.expectedErr, err)
+			}
+			if !tt.expectedErr && fmt.Sprintf("%T", actual) != tt.expected {
+				t.Errorf("wanted %s, got %T", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	cases := map[string]struct {
+		env         map[string]string
+		expected    Config
+		expectedErr bool
+	}{
+		"Defaults": {
+			expected: Config{Retention: defaultRetention, Rollups: rollupLevels},
+		},
+		"Settings from the environment": {
+			env: map[string]string{
+				storeEnv: dirStore, storeDirEnv: "/tmp/stats", retentionEnv: "336h",
+				csvExportKeyEnv: "export/history.csv", parquetExportKeyEnv: "export/history.parquet",
+			},
+			expected: Config{
+				StoreKind: dirStore, Dir: "/tmp/stats", Retention: 14 * 24 * time.Hour, Rollups: rollupLevels,
+				CSVExportKey: "export/history.csv", ParquetExportKey: "export/history.parquet",
+			},
+		},
+		"Invalid retention is an error": {
+			env:         map[string]string{retentionEnv: "2 weeks"},
+			expectedErr: true,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			for _, env := range []string{storeEnv, bucketNameEnv, storeDirEnv, retentionEnv, hourlyRollupRetentionEnv, dailyRollupRetentionEnv, csvExportKeyEnv, parquetExportKeyEnv} {
+				t.Setenv(env, "")
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			actual, err := LoadConfig()
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("wanted error %t, got %v", tt.expectedErr, err)
+			}
+			if !tt.expectedErr && !reflect.DeepEqual(tt.expected, actual) {
+				t.Errorf("wanted %+v, got %+v", tt.expected, actual)
+			}
+		})
+	}
+}
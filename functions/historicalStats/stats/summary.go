@@ -0,0 +1,204 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+// updateSummary summarizes each product from the raw history in the last window, predicts its availability from the
+// rollups in hourly, and saves it.  The window is the retention, so the summary covers all of the raw history.  The
+// summary is rebuilt from scratch every run, so when another run saves one first that one is kept.
+func (r *run) updateSummary(ctx context.Context, index *StatsIndex, hourly RollupLevel, window time.Duration) error {
+	history, err := r.getHistoryRange(ctx, index, r.now.Add(-window).Unix(), r.now.Unix())
+	if err != nil {
+		return err
+	}
+	summary := &Summary{
+		GeneratedAt:   r.now.Unix(),
+		WindowSeconds: int64(window.Seconds()),
+		Products:      []ProductSummary{},
+	}
+	for _, stat := range history.History {
+		summary.Products = append(summary.Products, summarizeProduct(stat, r.now))
+	}
+	var rollups Rollups
+	if _, err := r.readJSON(ctx, hourly.Key, &rollups, rollupUpgrades, tcinsByName(index.Current)); err != nil && !errors.Is(err, errNotFound) {
+		return err
+	}
+	addPredictions(summary, &rollups, history.History, r.now)
+	b, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	return r.replaceObject(ctx, schema.SummaryObjectKey, b)
+}
+
+// summarizeProduct computes the availability statistics for a product as of now.  Samples must be in time order.
+func summarizeProduct(stat HistoricalStat, now time.Time) ProductSummary {
+	summary := ProductSummary{TCIN: stat.TCIN, ProductName: stat.ProductName}
+	dayAgo := now.Add(-24 * time.Hour).Unix()
+	weekAgo := now.Add(-7 * 24 * time.Hour).Unix()
+	var samples24h, inStock24h, samples7d, inStock7d int
+	restocks := []int64{}
+	var droughtStart int64
+	inDrought := false
+	for i, d := range stat.Data {
+		inStock := d.Count > 0
+		if d.Time >= dayAgo {
+			samples24h++
+			if inStock {
+				inStock24h++
+			}
+		}
+		if d.Time >= weekAgo {
+			samples7d++
+			if inStock {
+				inStock7d++
+			}
+		}
+		if !inStock {
+			if !inDrought {
+				inDrought = true
+				droughtStart = d.Time
+			}
+			continue
+		}
+		summary.LastInStock = d.Time
+		if i > 0 && stat.Data[i-1].Count == 0 {
+			restocks = append(restocks, d.Time)
+		}
+		if inDrought {
+			inDrought = false
+			if drought := d.Time - droughtStart; drought > summary.LongestDroughtSeconds {
+				summary.LongestDroughtSeconds = drought
+			}
+		}
+	}
+	if inDrought {
+		if drought := stat.Data[len(stat.Data)-1].Time - droughtStart; drought > summary.LongestDroughtSeconds {
+			summary.LongestDroughtSeconds = drought
+		}
+	}
+	summary.InStockPercent24h = percent(inStock24h, samples24h)
+	summary.InStockPercent7d = percent(inStock7d, samples7d)
+	summary.Restocks = len(restocks)
+	if len(restocks) >= 2 {
+		summary.AverageRestockIntervalSeconds = (restocks[len(restocks)-1] - restocks[0]) / int64(len(restocks)-1)
+	}
+	if len(restocks) > 0 {
+		hours := make([]int, len(restocks))
+		weekdays := make([]int, len(restocks))
+		for i, r := range restocks {
+			t := time.Unix(r, 0).UTC()
+			hours[i] = t.Hour()
+			weekdays[i] = int(t.Weekday())
+		}
+		hour, weekday := mostCommon(hours), mostCommon(weekdays)
+		summary.TypicalRestockHour = &hour
+		summary.TypicalRestockWeekday = &weekday
+	}
+	summary.Stores = summarizeStores(stat.Data)
+	return summary
+}
+
+// recordedStores are the samples that recorded their stores.  Samples with stores but none listed are from before
+// stores were recorded.
+func recordedStores(data []HistoricalData) []HistoricalData {
+	recorded := []HistoricalData{}
+	for _, d := range data {
+		if d.Count > 0 && len(d.Stores) == 0 {
+			continue
+		}
+		recorded = append(recorded, d)
+	}
+	return recorded
+}
+
+// summarizeStores computes the statistics for each store in the samples, which must be in time order.  Only samples
+// that recorded their stores are counted.
+func summarizeStores(data []HistoricalData) []StoreSummary {
+	recorded := recordedStores(data)
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, d := range recorded {
+		for _, s := range d.Stores {
+			if !seen[s.StoreID] {
+				seen[s.StoreID] = true
+				ids = append(ids, s.StoreID)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Strings(ids)
+	stores := []StoreSummary{}
+	for _, id := range ids {
+		store := StoreSummary{StoreID: id}
+		inStockSamples := 0
+		inStockTimes := []int64{}
+		// restockedAt is when the current run of samples in stock started, if it started with a restock
+		var restockedAt int64
+		for i, d := range recorded {
+			inStock := d.Stores.Quantity(id) > 0
+			wasInStock := i > 0 && recorded[i-1].Stores.Quantity(id) > 0
+			switch {
+			case inStock:
+				inStockSamples++
+				store.LastInStock = d.Time
+				if i > 0 && !wasInStock {
+					store.Restocks++
+					restockedAt = d.Time
+				}
+			case wasInStock && restockedAt != 0:
+				inStockTimes = append(inStockTimes, d.Time-restockedAt)
+				restockedAt = 0
+			}
+		}
+		store.InStockPercent = percent(inStockSamples, len(recorded))
+		store.MedianInStockSeconds = median(inStockTimes)
+		stores = append(stores, store)
+	}
+	return stores
+}
+
+// median is the middle value, or the mean of the two middle values, or 0 if there are none.
+func median(values []int64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]int64{}, values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+// mostCommon returns the value that appears most often, or the smallest of those that tie.
+func mostCommon(values []int) int {
+	counts := map[int]int{}
+	for _, v := range values {
+		counts[v]++
+	}
+	best := values[0]
+	for v, n := range counts {
+		if n > counts[best] || (n == counts[best] && v < best) {
+			best = v
+		}
+	}
+	return best
+}
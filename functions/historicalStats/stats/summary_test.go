@@ -0,0 +1,217 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/davecgh/go-spew/spew"
+)
+
+func TestSummarizeProduct(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2022, 6, 8, 12, 0, 0, 0, time.UTC)
+	hoursAgo := func(h int) int64 { return now.Add(time.Duration(-h) * time.Hour).Unix() }
+	intPtr := func(i int) *int { return &i }
+	cases := map[string]struct {
+		stat     HistoricalStat
+		expected ProductSummary
+	}{
+		"Restocks and droughts are found": {
+			stat: HistoricalStat{
+				TCIN:        "123",
+				ProductName: "formula",
+				Data: []HistoricalData{
+					// restocks on Monday 10:00, Tuesday 09:00 and Wednesday 12:00, so each tie goes to the smallest
+					{Time: hoursAgo(60), Count: 0},
+					{Time: hoursAgo(50), Count: 2},
+					{Time: hoursAgo(40), Count: 0},
+					{Time: hoursAgo(27), Count: 3},
+					{Time: hoursAgo(20), Count: 0},
+					{Time: hoursAgo(12), Count: 0},
+					{Time: hoursAgo(0), Count: 1},
+				},
+			},
+			expected: ProductSummary{
+				TCIN:                          "123",
+				ProductName:                   "formula",
+				InStockPercent24h:             100 * 1.0 / 3,
+				InStockPercent7d:              100 * 3.0 / 7,
+				Restocks:                      3,
+				AverageRestockIntervalSeconds: 25 * 3600,
+				TypicalRestockHour:            intPtr(9),
+				TypicalRestockWeekday:         intPtr(int(time.Monday)),
+				LongestDroughtSeconds:         20 * 3600,
+				LastInStock:                   hoursAgo(0),
+			},
+		},
+		"Product still out of stock": {
+			stat: HistoricalStat{
+				ProductName: "formula",
+				Data: []HistoricalData{
+					{Time: hoursAgo(30), Count: 1},
+					{Time: hoursAgo(20), Count: 0},
+					{Time: hoursAgo(2), Count: 0},
+				},
+			},
+			expected: ProductSummary{
+				ProductName:           "formula",
+				InStockPercent24h:     0,
+				InStockPercent7d:      100 * 1.0 / 3,
+				LongestDroughtSeconds: 18 * 3600,
+				LastInStock:           hoursAgo(30),
+			},
+		},
+		"Samples older than a week are not in the percentage": {
+			stat: HistoricalStat{
+				ProductName: "formula",
+				Data: []HistoricalData{
+					{Time: hoursAgo(200), Count: 0},
+					{Time: hoursAgo(1), Count: 1},
+				},
+			},
+			expected: ProductSummary{
+				ProductName:           "formula",
+				InStockPercent24h:     100,
+				InStockPercent7d:      100,
+				Restocks:              1,
+				TypicalRestockHour:    intPtr(11),
+				TypicalRestockWeekday: intPtr(int(time.Wednesday)),
+				LongestDroughtSeconds: 199 * 3600,
+				LastInStock:           hoursAgo(1),
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual := summarizeProduct(tt.stat, now)
+			if !reflect.DeepEqual(tt.expected, actual) {
+				t.Error(spew.Printf("%v\n%v", tt.expected, actual))
+			}
+		})
+	}
+}
+
+func TestMostCommon(t *testing.T) {
+	cases := map[string]struct {
+		values   []int
+		expected int
+	}{
+		"Most common value":           {values: []int{3, 9, 9, 1}, expected: 9},
+		"Ties go to the smallest one": {values: []int{14, 3, 14, 3}, expected: 3},
+		"Single value":                {values: []int{0}, expected: 0},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			if actual := mostCommon(tt.values); actual != tt.expected {
+				t.Errorf("wanted %d, got %d", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestUpdateSummary(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	objects := map[string][]byte{
+		"history/2022-06-01.json": mustMarshal(t, HistoricalStats{History: []HistoricalStat{
+			{TCIN: "123", ProductName: "formula", Data: []HistoricalData{{Time: now.Add(-time.Hour).Unix()}, {Time: now.Unix(), Count: 3}}},
+		}}),
+		schema.SummaryObjectKey: []byte(`{"generated_at":1}`),
+	}
+	index := &StatsIndex{Partitions: []PartitionRef{
+		{Key: "history/2022-06-01.json", Start: now.Add(-time.Hour).Unix(), End: now.Unix()},
+	}}
+
+	if err := testRun(NewMemoryStatsStore(objects), now).updateSummary(context.Background(), index, rollupLevels[0], 14*24*time.Hour); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var summary Summary
+	if err := json.Unmarshal(objects[schema.SummaryObjectKey], &summary); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if summary.GeneratedAt != now.Unix() || summary.WindowSeconds != int64((14*24*time.Hour).Seconds()) {
+		t.Error(spew.Sprintf("expected the summary to be replaced: %v", summary))
+	}
+	if len(summary.Products) != 1 || summary.Products[0].TCIN != "123" || summary.Products[0].Restocks != 1 {
+		t.Error(spew.Sprintf("unexpected products: %v", summary.Products))
+	}
+}
+
+func TestSummarizeStores(t *testing.T) {
+	stores := func(pairs ...schema.StoreSample) schema.StoreSamples { return pairs }
+	cases := map[string]struct {
+		data     []HistoricalData
+		expected []StoreSummary
+	}{
+		"Restocks and time in stock are per store": {
+			data: []HistoricalData{
+				{Time: 0},
+				{Time: 100, Count: 1, Stores: stores(schema.StoreSample{StoreID: "1234", Quantity: 2})},
+				{Time: 200, Count: 2, Stores: stores(schema.StoreSample{StoreID: "1234", Quantity: 1}, schema.StoreSample{StoreID: "5678", Quantity: 4})},
+				{Time: 300, Count: 1, Stores: stores(schema.StoreSample{StoreID: "5678", Quantity: 3})},
+				{Time: 400, Count: 1, Stores: stores(schema.StoreSample{StoreID: "1234", Quantity: 5})},
+				{Time: 800},
+			},
+			expected: []StoreSummary{
+				{StoreID: "1234", InStockPercent: 50, Restocks: 2, MedianInStockSeconds: 300, LastInStock: 400},
+				{StoreID: "5678", InStockPercent: 100 * 2.0 / 6, Restocks: 1, MedianInStockSeconds: 200, LastInStock: 300},
+			},
+		},
+		"Samples from before stores were recorded are skipped": {
+			data: []HistoricalData{
+				{Time: 100, Count: 3},
+				{Time: 200, Count: 1, Stores: stores(schema.StoreSample{StoreID: "1234", Quantity: 1})},
+				{Time: 300, Count: 3},
+			},
+			expected: []StoreSummary{
+				{StoreID: "1234", InStockPercent: 100, LastInStock: 200},
+			},
+		},
+		"Stores sold out with zero quantity are out of stock": {
+			data: []HistoricalData{
+				{Time: 100, Count: 1, Stores: stores(schema.StoreSample{StoreID: "1234", Quantity: 0})},
+				{Time: 200, Count: 1, Stores: stores(schema.StoreSample{StoreID: "1234", Quantity: 1})},
+			},
+			expected: []StoreSummary{
+				{StoreID: "1234", InStockPercent: 50, Restocks: 1, LastInStock: 200},
+			},
+		},
+		"No stores recorded": {
+			data: []HistoricalData{{Time: 100, Count: 1}, {Time: 200}},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual := summarizeStores(tt.data)
+			if !reflect.DeepEqual(tt.expected, actual) {
+				t.Error(spew.Printf("%v\n%v", tt.expected, actual))
+			}
+		})
+	}
+}
+
+func TestMedian(t *testing.T) {
+	cases := map[string]struct {
+		values   []int64
+		expected int64
+	}{
+		"Odd count":  {values: []int64{30, 10, 20}, expected: 20},
+		"Even count": {values: []int64{40, 10, 20, 30}, expected: 25},
+		"No values":  {expected: 0},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			if actual := median(tt.values); actual != tt.expected {
+				t.Errorf("wanted %d, got %d", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+"""Writes export.parquet, the golden file for TestEncodeParquet_Golden.
+
+The rows are parquetGoldenRows in parquet_test.go, and the options are the ones writeParquet uses: required columns,
+PLAIN encoding without dictionaries, no compression and version 1 data pages.  Run it from this directory with
+pyarrow installed:
+
+    python3 export_parquet.py
+"""
+
+import pyarrow as pa
+import pyarrow.parquet as pq
+
+schema = pa.schema([
+    pa.field("time", pa.int64(), nullable=False),
+    pa.field("tcin", pa.string(), nullable=False),
+    pa.field("product_name", pa.string(), nullable=False),
+    pa.field("store_id", pa.string(), nullable=False),
+    pa.field("store_quantity", pa.int32(), nullable=False),
+    pa.field("count", pa.int32(), nullable=False),
+    pa.field("units", pa.int32(), nullable=False),
+    pa.field("shipping_available", pa.bool_(), nullable=False),
+    pa.field("shipping_quantity", pa.int32(), nullable=False),
+])
+
+rows = [
+    (1654084800, "123", "formula", "1234", 3, 2, 4, True, 10),
+    (1654084800, "123", "formula", "5678", -1, 2, 4, False, 0),
+    (1654088400, "456", "fórmula", "", 0, 0, 0, False, 0),
+]
+
+table = pa.Table.from_pylist([dict(zip(schema.names, r)) for r in rows], schema=schema)
+pq.write_table(
+    table,
+    "export.parquet",
+    use_dictionary=False,
+    compression="NONE",
+    write_statistics=False,
+    data_page_version="1.0",
+    store_schema=False,
+)
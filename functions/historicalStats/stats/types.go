@@ -0,0 +1,43 @@
+package stats
+
+import (
+	"context"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type S3API interface {
+	S3GetObjectAPI
+	S3PutObjectAPI
+	S3DeleteObjectAPI
+}
+
+type S3PutObjectAPI interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+type S3GetObjectAPI interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+type S3DeleteObjectAPI interface {
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// The stats document types are shared with the other functions through the schema module.
+type (
+	HistoricalStats = schema.HistoricalStats
+	HistoricalStat  = schema.HistoricalStat
+	HistoricalData  = schema.HistoricalData
+	StatsIndex      = schema.StatsIndex
+	PartitionRef    = schema.PartitionRef
+	Rollups         = schema.Rollups
+	ProductRollup   = schema.ProductRollup
+	RollupBucket    = schema.RollupBucket
+	Summary         = schema.Summary
+	ProductSummary  = schema.ProductSummary
+	ForecastWindow  = schema.ForecastWindow
+	StoreSummary    = schema.StoreSummary
+	ProductState    = schema.ProductState
+)
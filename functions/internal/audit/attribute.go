@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Item is a DynamoDB item, or a key, by attribute name.  It can be passed to the SDK as is.
+type Item map[string]types.AttributeValue
+
+func String(s string) types.AttributeValue {
+	return &types.AttributeValueMemberS{Value: s}
+}
+
+func Int(i int64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(i, 10)}
+}
+
+func Float(f float64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatFloat(f, 'f', -1, 64)}
+}
+
+func Bool(b bool) types.AttributeValue {
+	return &types.AttributeValueMemberBOOL{Value: b}
+}
+
+func Map(m Item) types.AttributeValue {
+	return &types.AttributeValueMemberM{Value: m}
+}
+
+func List(l ...types.AttributeValue) types.AttributeValue {
+	return &types.AttributeValueMemberL{Value: l}
+}
+
+// String is the named string attribute, or "" if it is missing or not a string.
+func (i Item) String(name string) string {
+	if v, ok := i[name].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+// Int is the named number attribute as an integer, or 0 if it is missing or not an integer.
+func (i Item) Int(name string) int64 {
+	if v, ok := i[name].(*types.AttributeValueMemberN); ok {
+		n, _ := strconv.ParseInt(v.Value, 10, 64)
+		return n
+	}
+	return 0
+}
+
+// Float is the named number attribute, or 0 if it is missing or not a number.
+func (i Item) Float(name string) float64 {
+	if v, ok := i[name].(*types.AttributeValueMemberN); ok {
+		f, _ := strconv.ParseFloat(v.Value, 64)
+		return f
+	}
+	return 0
+}
+
+// Bool is the named boolean attribute, or false if it is missing or not a boolean.
+func (i Item) Bool(name string) bool {
+	if v, ok := i[name].(*types.AttributeValueMemberBOOL); ok {
+		return v.Value
+	}
+	return false
+}
+
+// List is the named list attribute, or nil if it is missing or not a list.
+func (i Item) List(name string) []types.AttributeValue {
+	if v, ok := i[name].(*types.AttributeValueMemberL); ok {
+		return v.Value
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// The results table keeps several kinds of item, told apart by their keys:
+//
+//	PK              SK                     GSI1PK               GSI1SK
+//	TCIN#<tcin>     RESULT#<checked at>    INSTOCK#<date>       <checked at>#<tcin>
+//	LATEST          TCIN#<tcin>
+//
+// Each check writes a result item, which has GSI1 keys only when the product was in stock, so GSI1 holds just the
+// in-stock results by date.  The latest item for the product is replaced with a copy of it, on LatestCondition.
+// Times in keys are RFC 3339 in UTC, so they sort in time order, and dates are UTC days.
+const (
+	PartitionKey  = "PK"
+	SortKey       = "SK"
+	InStockIndex  = "GSI1"
+	InStockKey    = "GSI1PK"
+	InStockSort   = "GSI1SK"
+	TTLAttribute  = "TTL"
+	LatestKey     = "LATEST"
+	tcinPrefix    = "TCIN#"
+	resultPrefix  = "RESULT#"
+	inStockPrefix = "INSTOCK#"
+	dateLayout    = "2006-01-02"
+	// LatestCondition only replaces the latest item with a result checked at the same time or later, given as
+	// :checked_at, so a slow check saved after a newer one does not replace it.
+	LatestCondition = "attribute_not_exists(checked_at) OR checked_at <= :checked_at"
+)
+
+// Result is the audit record of a single check of a product.
+type Result struct {
+	TCIN            string `json:"tcin"`
+	Name            string `json:"name"`
+	DesiredQuantity int    `json:"desired_quantity"`
+	CheckedAt       int64  `json:"checked_at"`
+	// Status is schema.StatusInStock when any store has the product, or else schema.StatusOutOfStock.
+	Status            string          `json:"status"`
+	TotalStores       int             `json:"total_stores"`
+	Units             int             `json:"units"`
+	Stores            []StoreQuantity `json:"stores"`
+	ShippingAvailable bool            `json:"shipping_available"`
+	ShippingQuantity  int             `json:"shipping_quantity"`
+	// Price is the current retail price in dollars, or 0 when it could not be read.
+	Price float64 `json:"price"`
+	// TTL is set from the RetentionPolicy when the result is saved.
+	TTL int64 `json:"ttl"`
+}
+
+// StoreQuantity is the quantity of the product at a single store.
+type StoreQuantity struct {
+	StoreID      string  `json:"store_id"`
+	LocationName string  `json:"location_name"`
+	Quantity     int     `json:"quantity"`
+	Distance     float64 `json:"distance"`
+}
+
+// NewResult is the record of checking the product in q at checkedAt, without a TTL.
+func NewResult(q schema.ProductQuery, result schema.ProductResult, checkedAt time.Time) Result {
+	r := Result{
+		TCIN:              q.TCIN,
+		Name:              q.Name,
+		DesiredQuantity:   q.DesiredQuantity,
+		CheckedAt:         checkedAt.Unix(),
+		Status:            schema.StatusOutOfStock,
+		TotalStores:       result.Pickup.TotalStores,
+		Stores:            []StoreQuantity{},
+		ShippingAvailable: result.Shipping.IsAvailable,
+		ShippingQuantity:  result.Shipping.AvailableToPromise,
+	}
+	if r.TotalStores > 0 {
+		r.Status = schema.StatusInStock
+	}
+	for _, s := range result.Pickup.Stores {
+		r.Units += s.AvailableToPromise
+		r.Stores = append(r.Stores, StoreQuantity{StoreID: s.StoreID, LocationName: s.LocationName, Quantity: s.AvailableToPromise, Distance: s.Distance})
+	}
+	return r
+}
+
+// ResultKey is the key of the result item for the product checked at t.
+func ResultKey(tcin string, t time.Time) Item {
+	return Item{PartitionKey: String(tcinPrefix + tcin), SortKey: String(resultPrefix + formatKeyTime(t))}
+}
+
+// ProductKey is the partition key value of the results for the product.
+func ProductKey(tcin string) string {
+	return tcinPrefix + tcin
+}
+
+// ResultSortKey is the sort key value of the result item checked at t, for key conditions on a time range.
+func ResultSortKey(t time.Time) string {
+	return resultPrefix + formatKeyTime(t)
+}
+
+// InStockDateKey is the GSI1 partition key value of the in-stock results on the UTC day of t.
+func InStockDateKey(t time.Time) string {
+	return inStockPrefix + t.UTC().Format(dateLayout)
+}
+
+// InStockSortKey is the lowest GSI1 sort key value of the in-stock results checked at t, for key conditions on a time
+// range.
+func InStockSortKey(t time.Time) string {
+	return formatKeyTime(t)
+}
+
+// Items are the result item and the latest item for the product.
+func (r Result) Items() []Item {
+	checked := time.Unix(r.CheckedAt, 0)
+	result := r.attributes()
+	for k, v := range ResultKey(r.TCIN, checked) {
+		result[k] = v
+	}
+	if r.Status == schema.StatusInStock {
+		result[InStockKey] = String(InStockDateKey(checked))
+		result[InStockSort] = String(formatKeyTime(checked) + "#" + r.TCIN)
+	}
+	latest := r.attributes()
+	latest[PartitionKey] = String(LatestKey)
+	latest[SortKey] = String(tcinPrefix + r.TCIN)
+	return []Item{result, latest}
+}
+
+func (r Result) attributes() Item {
+	item := Item{
+		"tcin":               String(r.TCIN),
+		"name":               String(r.Name),
+		"desired_quantity":   Int(int64(r.DesiredQuantity)),
+		"checked_at":         Int(r.CheckedAt),
+		"status":             String(r.Status),
+		"total_stores":       Int(int64(r.TotalStores)),
+		"units":              Int(int64(r.Units)),
+		"shipping_available": Bool(r.ShippingAvailable),
+		"shipping_quantity":  Int(int64(r.ShippingQuantity)),
+		TTLAttribute:         Int(r.TTL),
+	}
+	// DynamoDB has no empty list value with omitempty, so no stores is a missing attribute
+	if len(r.Stores) > 0 {
+		stores := make([]types.AttributeValue, len(r.Stores))
+		for i, s := range r.Stores {
+			stores[i] = Map(Item{
+				"store_id":      String(s.StoreID),
+				"location_name": String(s.LocationName),
+				"quantity":      Int(int64(s.Quantity)),
+				"distance":      Float(s.Distance),
+			})
+		}
+		item["stores"] = List(stores...)
+	}
+	// an unknown price is a missing attribute, rather than a price of 0
+	if r.Price > 0 {
+		item["price"] = Float(r.Price)
+	}
+	return item
+}
+
+// ResultFromItem reads a result or latest item.
+func ResultFromItem(item Item) Result {
+	r := Result{
+		TCIN:              item.String("tcin"),
+		Name:              item.String("name"),
+		DesiredQuantity:   int(item.Int("desired_quantity")),
+		CheckedAt:         item.Int("checked_at"),
+		Status:            item.String("status"),
+		TotalStores:       int(item.Int("total_stores")),
+		Units:             int(item.Int("units")),
+		Stores:            []StoreQuantity{},
+		ShippingAvailable: item.Bool("shipping_available"),
+		ShippingQuantity:  int(item.Int("shipping_quantity")),
+		Price:             item.Float("price"),
+		TTL:               item.Int(TTLAttribute),
+	}
+	for _, v := range item.List("stores") {
+		m, ok := v.(*types.AttributeValueMemberM)
+		if !ok {
+			continue
+		}
+		s := Item(m.Value)
+		r.Stores = append(r.Stores, StoreQuantity{
+			StoreID:      s.String("store_id"),
+			LocationName: s.String("location_name"),
+			Quantity:     int(s.Int("quantity")),
+			Distance:     s.Float("distance"),
+		})
+	}
+	return r
+}
+
+func formatKeyTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestNewResult(t *testing.T) {
+	checkedAt := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	q := schema.ProductQuery{Name: "formula", TCIN: "123", DesiredQuantity: 2}
+	result := schema.ProductResult{
+		Pickup: schema.PickupResult{TotalStores: 2, Stores: []schema.StoreResult{
+			{StoreID: "1234", LocationName: "Denver", AvailableToPromise: 3, Distance: 1.5},
+			{StoreID: "5678", LocationName: "Aurora", AvailableToPromise: 1, Distance: 7},
+		}},
+		Shipping: schema.ShippingResult{IsAvailable: true, AvailableToPromise: 10},
+	}
+	expected := Result{
+		TCIN: "123", Name: "formula", DesiredQuantity: 2, CheckedAt: checkedAt.Unix(), Status: schema.StatusInStock,
+		TotalStores: 2, Units: 4,
+		Stores: []StoreQuantity{
+			{StoreID: "1234", LocationName: "Denver", Quantity: 3, Distance: 1.5},
+			{StoreID: "5678", LocationName: "Aurora", Quantity: 1, Distance: 7},
+		},
+		ShippingAvailable: true, ShippingQuantity: 10,
+	}
+
+	if actual := NewResult(q, result, checkedAt); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("wanted %+v, got %+v", expected, actual)
+	}
+}
+
+func TestResult_Items(t *testing.T) {
+	checkedAt := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	cases := map[string]struct {
+		result          Result
+		expectedInStock string
+	}{
+		"In stock results are in the in-stock index": {
+			result: Result{
+				TCIN: "123", Name: "formula", CheckedAt: checkedAt.Unix(), Status: schema.StatusInStock, TotalStores: 1, Units: 3,
+				Stores: []StoreQuantity{{StoreID: "1234", LocationName: "Denver", Quantity: 3, Distance: 1.5}}, Price: 18.99,
+				TTL: 99,
+			},
+			expectedInStock: "INSTOCK#2022-06-01",
+		},
+		"Out of stock results are not": {
+			result: Result{TCIN: "123", Name: "formula", CheckedAt: checkedAt.Unix(), Status: schema.StatusOutOfStock, Stores: []StoreQuantity{}, TTL: 99},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			items := tt.result.Items()
+			if len(items) != 2 {
+				t.Fatalf("expected the result and latest items, got %d", len(items))
+			}
+			result, latest := items[0], items[1]
+			if result.String(PartitionKey) != "TCIN#123" || result.String(SortKey) != "RESULT#2022-06-01T12:00:00Z" {
+				t.Errorf("unexpected result key: %v", result)
+			}
+			if latest.String(PartitionKey) != LatestKey || latest.String(SortKey) != "TCIN#123" {
+				t.Errorf("unexpected latest key: %v", latest)
+			}
+			if result.String(InStockKey) != tt.expectedInStock {
+				t.Errorf("wanted in-stock key %q, got %q", tt.expectedInStock, result.String(InStockKey))
+			}
+			if tt.expectedInStock != "" && result.String(InStockSort) != "2022-06-01T12:00:00Z#123" {
+				t.Errorf("unexpected in-stock sort key %q", result.String(InStockSort))
+			}
+			if _, ok := result["price"]; ok != (tt.result.Price > 0) {
+				t.Errorf("expected a price attribute only for a known price, got %v", result["price"])
+			}
+			if _, ok := latest[InStockKey]; ok {
+				t.Error("expected the latest item to be left out of the in-stock index")
+			}
+			for _, item := range items {
+				if actual := ResultFromItem(item); !reflect.DeepEqual(tt.result, actual) {
+					t.Errorf("wanted %+v, got %+v", tt.result, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestItem(t *testing.T) {
+	item := Item{
+		"name":   String("formula"),
+		"count":  Int(3),
+		"ok":     Bool(true),
+		"stores": List(Map(Item{"distance": Float(1.5)})),
+	}
+	cases := map[string]struct {
+		actual   interface{}
+		expected interface{}
+	}{
+		"String":            {actual: item.String("name"), expected: "formula"},
+		"Int":               {actual: item.Int("count"), expected: int64(3)},
+		"Bool":              {actual: item.Bool("ok"), expected: true},
+		"Float in a list":   {actual: Item(item.List("stores")[0].(*types.AttributeValueMemberM).Value).Float("distance"), expected: 1.5},
+		"Missing attribute": {actual: item.Int("missing"), expected: int64(0)},
+		"Wrong type":        {actual: item.String("count"), expected: ""},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.expected, tt.actual) {
+				t.Errorf("wanted %v, got %v", tt.expected, tt.actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+// RetentionPolicy is how long results are kept in the table, by their status.
+type RetentionPolicy struct {
+	InStock    time.Duration
+	OutOfStock time.Duration
+}
+
+// ForProduct is the policy with the durations set in the product's retention, if it has one.
+func (p RetentionPolicy) ForProduct(q schema.ProductQuery) (RetentionPolicy, error) {
+	if q.Retention == nil {
+		return p, nil
+	}
+	var err error
+	if p.InStock, err = ParseRetention(q.Retention.InStock, p.InStock); err != nil {
+		return p, fmt.Errorf("in stock retention of %s: %w", q.TCIN, err)
+	}
+	if p.OutOfStock, err = ParseRetention(q.Retention.OutOfStock, p.OutOfStock); err != nil {
+		return p, fmt.Errorf("out of stock retention of %s: %w", q.TCIN, err)
+	}
+	return p, nil
+}
+
+// TTL is when DynamoDB may delete the result, in Unix seconds.
+func (p RetentionPolicy) TTL(r Result) int64 {
+	d := p.OutOfStock
+	if r.Status == schema.StatusInStock {
+		d = p.InStock
+	}
+	return r.CheckedAt + int64(d/time.Second)
+}
+
+// ParseRetention reads a positive Go duration, e.g. "2160h", or returns def if raw is empty.
+func ParseRetention(raw string, def time.Duration) (time.Duration, error) {
+	if raw == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("retention must be positive, got %s", d)
+	}
+	return d, nil
+}
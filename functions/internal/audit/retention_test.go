@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+func TestRetentionPolicy_ForProduct(t *testing.T) {
+	policy := RetentionPolicy{InStock: 90 * 24 * time.Hour, OutOfStock: 72 * time.Hour}
+	cases := map[string]struct {
+		retention   *schema.Retention
+		expected    RetentionPolicy
+		expectedErr bool
+	}{
+		"No retention keeps the policy": {
+			expected: policy,
+		},
+		"Retention replaces the durations it sets": {
+			retention: &schema.Retention{InStock: "8760h"},
+			expected:  RetentionPolicy{InStock: 365 * 24 * time.Hour, OutOfStock: 72 * time.Hour},
+		},
+		"Invalid duration is an error": {
+			retention:   &schema.Retention{OutOfStock: "3d"},
+			expectedErr: true,
+		},
+		"Duration must be positive": {
+			retention:   &schema.Retention{InStock: "0s"},
+			expectedErr: true,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := policy.ForProduct(schema.ProductQuery{TCIN: "123", Retention: tt.retention})
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("wanted error %t, got %v", tt.expectedErr, err)
+			}
+			if !tt.expectedErr && actual != tt.expected {
+				t.Errorf("wanted %+v, got %+v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRetentionPolicy_TTL(t *testing.T) {
+	policy := RetentionPolicy{InStock: 90 * 24 * time.Hour, OutOfStock: 72 * time.Hour}
+	checkedAt := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	cases := map[string]struct {
+		status   string
+		expected time.Time
+	}{
+		"In stock":     {status: schema.StatusInStock, expected: time.Date(2022, 8, 30, 12, 0, 0, 0, time.UTC)},
+		"Out of stock": {status: schema.StatusOutOfStock, expected: time.Date(2022, 6, 4, 12, 0, 0, 0, time.UTC)},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			if actual := policy.TTL(Result{CheckedAt: checkedAt.Unix(), Status: tt.status}); actual != tt.expected.Unix() {
+				t.Errorf("wanted %s, got %s", tt.expected, time.Unix(actual, 0).UTC())
+			}
+		})
+	}
+}
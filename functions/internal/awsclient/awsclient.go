@@ -0,0 +1,68 @@
+// Package awsclient creates the AWS service clients shared by the functions.
+package awsclient
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-xray-sdk-go/instrumentation/awsv2"
+)
+
+const (
+	// S3URIEnv overrides the S3 endpoint, e.g. to use Localstack.
+	S3URIEnv = "S3_URI_OVERRIDE"
+	// DynamoDBURIEnv overrides the DynamoDB endpoint, e.g. to use DynamoDB Local.
+	DynamoDBURIEnv = "DYNAMODB_URI_OVERRIDE"
+)
+
+// S3 creates an S3 client.  When S3_URI_OVERRIDE is set the client uses that endpoint with path style requests, as
+// Localstack requires, otherwise the calls are recorded with X-Ray.
+func S3(ctx context.Context, logger *log.Logger) (*s3.Client, error) {
+	uri := os.Getenv(S3URIEnv)
+	cfg, err := loadConfig(ctx, logger, uri)
+	if err != nil {
+		return nil, err
+	}
+	if uri != "" {
+		return s3.NewFromConfig(cfg, func(o *s3.Options) {
+			o.UsePathStyle = true
+		}), nil
+	}
+	return s3.NewFromConfig(cfg), nil
+}
+
+// DynamoDB creates a DynamoDB client.  When DYNAMODB_URI_OVERRIDE is set the client uses that endpoint, otherwise the
+// calls are recorded with X-Ray.
+func DynamoDB(ctx context.Context, logger *log.Logger) (*dynamodb.Client, error) {
+	cfg, err := loadConfig(ctx, logger, os.Getenv(DynamoDBURIEnv))
+	if err != nil {
+		return nil, err
+	}
+	return dynamodb.NewFromConfig(cfg), nil
+}
+
+// loadConfig loads the default config, resolving every service to uri if it is set.  Otherwise the calls are
+// recorded with X-Ray.
+func loadConfig(ctx context.Context, logger *log.Logger, uri string) (aws.Config, error) {
+	if uri != "" {
+		logger.Printf("Custom endpoint URI found: %s\n", uri)
+		endpointCfg := config.WithEndpointResolverWithOptions(aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+			return aws.Endpoint{
+				URL: uri,
+			}, nil
+		}))
+		return config.LoadDefaultConfig(ctx, endpointCfg)
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return cfg, err
+	}
+	os.Setenv("AWS_XRAY_CONTEXT_MISSING", "LOG_ERROR")
+	awsv2.AWSV2Instrumentor(&cfg.APIOptions)
+	return cfg, nil
+}
@@ -7,16 +7,37 @@ type ProductsInput struct {
 
 // ProductQuery is a single event sent from the Step Function and contains information to query the API.
 type ProductQuery struct {
-	Name            string `json:"name"`
-	DesiredQuantity int    `json:"desired_quantity"`
-	ProductURL      string `json:"product_url"`
-	TCIN            string `json:"tcin"`
+	Name            string     `json:"name"`
+	DesiredQuantity int        `json:"desired_quantity"`
+	ProductURL      string     `json:"product_url"`
+	TCIN            string     `json:"tcin"`
+	Retention       *Retention `json:"retention,omitempty"`
+}
+
+// Retention is how long the results of checking the product are kept, as Go durations, e.g. "2160h".  A duration that
+// is not set is the default of the Product Checker.
+type Retention struct {
+	InStock    string `json:"in_stock,omitempty"`
+	OutOfStock string `json:"out_of_stock,omitempty"`
 }
 
 // Product is an internal state gathering the query and result information for a given product.
+// Error is set by the Step Function when checking the product failed, and Result is then empty.
 type Product struct {
 	ProductQuery
 	Result ProductResult `json:"result"`
+	Error  *CheckError   `json:"error,omitempty"`
+}
+
+// CheckError is the error caught by the Step Function when the Product Checker fails.
+type CheckError struct {
+	Error string `json:"Error"`
+	Cause string `json:"Cause"`
+}
+
+// Failed reports if checking the product failed, so Result is not known.
+func (p Product) Failed() bool {
+	return p.Error != nil
 }
 
 // PickupResult is a collection of stores that are available for in-store pickup.
@@ -32,17 +53,21 @@ type ShippingResult struct {
 }
 
 // ProductResult is the result of querying the API for the given product.
-// `db_ttl` is included so if we persist this result, we have a TTL available.  We do it here so we don't have a lambda
-// in the StepFunction that is just generating timestamps.
 type ProductResult struct {
 	Pickup   PickupResult   `json:"pickup,omitempty"`
 	Shipping ShippingResult `json:"shipping,omitempty"`
-	DBTTL    int64          `json:"db_ttl"`
+}
+
+// Available reports if the product can be picked up at any store or shipped.
+func (r ProductResult) Available() bool {
+	return r.Pickup.TotalStores > 0 || r.Shipping.IsAvailable
 }
 
 // StoreResult is an individual store information for the given product.
+// Distance is in miles from the location used to query the API.
 type StoreResult struct {
 	AvailableToPromise int                 `json:"available"`
+	Distance           float64             `json:"distance"`
 	LocationName       string              `json:"location_name"`
 	MailingAddress     StoreMailingAddress `json:"mailing_address"`
 	StoreID            string              `json:"store_id"`
@@ -0,0 +1,51 @@
+package schema
+
+const (
+	// HourlyRollupKey is where the hourly rollups are kept in the stats bucket.
+	HourlyRollupKey = "rollups/hourly.json"
+	// DailyRollupKey is where the daily rollups are kept in the stats bucket.
+	DailyRollupKey = "rollups/daily.json"
+)
+
+// Rollups are samples aggregated into fixed size buckets, so long periods of history stay small.
+type Rollups struct {
+	// Version is the format of the document, the same as HistoricalStats.Version.
+	Version int `json:"version,omitempty"`
+	// BucketSeconds is the size of each bucket.
+	BucketSeconds int64 `json:"bucket_seconds"`
+	// LastUpdatedAt is the time of the newest sample included in the rollups.
+	LastUpdatedAt int64           `json:"last_updated_at"`
+	Products      []ProductRollup `json:"products"`
+}
+
+// ProductRollup is the series of buckets for a single product, oldest first.
+type ProductRollup struct {
+	TCIN        string         `json:"tcin"`
+	ProductName string         `json:"product_name"`
+	Buckets     []RollupBucket `json:"buckets"`
+}
+
+// Key identifies the product in the rollups, the same as HistoricalStat.Key.
+func (p ProductRollup) Key() string {
+	return HistoricalStat{TCIN: p.TCIN, ProductName: p.ProductName}.Key()
+}
+
+// RollupBucket summarizes the samples taken between Start and Start + BucketSeconds.
+type RollupBucket struct {
+	Start          int64   `json:"start"`
+	Samples        int     `json:"samples"`
+	InStockSamples int     `json:"in_stock_samples"`
+	Min            int     `json:"min"`
+	Max            int     `json:"max"`
+	Mean           float64 `json:"mean"`
+	InStockPercent float64 `json:"in_stock_percent"`
+	// FirstInStock and LastInStock are the times of the first and last samples with stores, if any.
+	FirstInStock int64 `json:"first_in_stock,omitempty"`
+	LastInStock  int64 `json:"last_in_stock,omitempty"`
+	MaxUnits     int   `json:"max_units"`
+	// ShippingSamples is the number of samples where the product could be shipped.
+	ShippingSamples int     `json:"shipping_samples"`
+	ShippingPercent float64 `json:"shipping_percent"`
+	// FirstShipping is the time of the first sample where the product could be shipped, if any.
+	FirstShipping int64 `json:"first_shipping,omitempty"`
+}
@@ -0,0 +1,25 @@
+package schema
+
+// Statuses of a product in its ProductState.
+const (
+	StatusInStock    = "in_stock"
+	StatusOutOfStock = "out_of_stock"
+	StatusFailed     = "failed"
+)
+
+// ProductState is what is currently known about a product.  It is kept when the product is removed from the input, so
+// it is still there if the product is added back.
+type ProductState struct {
+	TCIN       string `json:"tcin,omitempty"`
+	Name       string `json:"name"`
+	ProductURL string `json:"product_url,omitempty"`
+	// LastChecked is the time of the last run that had the product, whether or not the check succeeded.
+	LastChecked int64 `json:"last_checked"`
+	// LastInStock is the time of the last check that found the product at any store or for shipping.
+	LastInStock int64  `json:"last_in_stock,omitempty"`
+	Status      string `json:"status"`
+	// Result is from the last successful check.
+	Result ProductResult `json:"result"`
+	// ConsecutiveFailures is the number of checks that have failed since the last one that succeeded.
+	ConsecutiveFailures int `json:"consecutive_failures"`
+}
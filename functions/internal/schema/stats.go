@@ -0,0 +1,187 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// StatsObjectKey is the index of the historical stats in the stats bucket.
+	StatsObjectKey = "historical_stats.json"
+	// PartitionPrefix is where the per-day history partitions are kept in the stats bucket.
+	PartitionPrefix = "history/"
+	partitionLayout = "2006-01-02"
+	// StatsVersion is the version of the HistoricalStats and Rollups documents written by this code.
+	// Version 1 is history keyed by product name, and version 2 is history keyed by TCIN.
+	StatsVersion = 2
+)
+
+// StatsIndex is the small object that lists the history partitions and the current state of each product, keyed by
+// its HistoryKey.
+type StatsIndex struct {
+	CreatedAt     int64                   `json:"created_at"`
+	LastUpdatedAt int64                   `json:"last_updated_at"`
+	Current       map[string]ProductState `json:"current"`
+	Partitions    []PartitionRef          `json:"partitions"`
+}
+
+// PartitionRef points to a single partition of history and the times of the first and last samples in it.
+type PartitionRef struct {
+	Key   string `json:"key"`
+	Start int64  `json:"start"`
+	End   int64  `json:"end"`
+}
+
+// HistoricalStats is a collection of history.  Each partition is stored as HistoricalStats, and readers assemble
+// one from the index and the partitions they need.
+type HistoricalStats struct {
+	// Version is the format of the document.  Documents without a version are version 1.
+	Version       int              `json:"version,omitempty"`
+	CreatedAt     int64            `json:"created_at"`
+	LastUpdatedAt int64            `json:"last_updated_at"`
+	History       []HistoricalStat `json:"history"`
+}
+
+// HistoricalStat is the series of samples for a single product.  History is keyed by TCIN, and ProductName is the
+// name the product had when it was last sampled.
+type HistoricalStat struct {
+	TCIN        string           `json:"tcin"`
+	ProductName string           `json:"product_name"`
+	Data        []HistoricalData `json:"data"`
+}
+
+// HistoricalData is a single sample of the product's availability at a point in time.
+// Count is the number of stores with the product and Units is the total available across those stores.
+// Samples taken before units and shipping were recorded have them as zero, and samples taken before stores were
+// recorded have no Stores.
+type HistoricalData struct {
+	Time              int64        `json:"time"`
+	Count             int          `json:"count"`
+	Units             int          `json:"units"`
+	ShippingAvailable bool         `json:"shipping_available"`
+	ShippingQuantity  int          `json:"shipping_quantity"`
+	Stores            StoreSamples `json:"stores,omitempty"`
+}
+
+// Available reports if the product could be picked up at any store or shipped when it was sampled, like
+// ProductResult.Available.
+func (d HistoricalData) Available() bool {
+	return d.Count > 0 || d.ShippingAvailable
+}
+
+// StoreSample is the quantity available at a single store.
+type StoreSample struct {
+	StoreID  string
+	Quantity int
+}
+
+// StoreSamples are the stores with the product in a sample.  They are saved as a single string of
+// "<store id>:<quantity>" pairs separated by commas, e.g. "1234:3,5678:1", to keep partitions small.
+type StoreSamples []StoreSample
+
+func (s StoreSamples) MarshalJSON() ([]byte, error) {
+	pairs := make([]string, len(s))
+	for i, store := range s {
+		pairs[i] = store.StoreID + ":" + strconv.Itoa(store.Quantity)
+	}
+	return json.Marshal(strings.Join(pairs, ","))
+}
+
+func (s *StoreSamples) UnmarshalJSON(b []byte) error {
+	var encoded string
+	if err := json.Unmarshal(b, &encoded); err != nil {
+		return err
+	}
+	*s = nil
+	if encoded == "" {
+		return nil
+	}
+	for _, pair := range strings.Split(encoded, ",") {
+		id, quantity, ok := strings.Cut(pair, ":")
+		if !ok {
+			return fmt.Errorf("store sample %q is not <store id>:<quantity>", pair)
+		}
+		q, err := strconv.Atoi(quantity)
+		if err != nil {
+			return fmt.Errorf("store sample %q: %w", pair, err)
+		}
+		*s = append(*s, StoreSample{StoreID: id, Quantity: q})
+	}
+	return nil
+}
+
+// Quantity is the quantity at the store, or 0 if it is not in the sample.
+func (s StoreSamples) Quantity(storeID string) int {
+	for _, store := range s {
+		if store.StoreID == storeID {
+			return store.Quantity
+		}
+	}
+	return 0
+}
+
+// Key identifies the product in the history.  This is the TCIN, or the product name for history recorded before TCINs
+// were tracked that could not be migrated to them.
+func (s HistoricalStat) Key() string {
+	if s.TCIN != "" {
+		return s.TCIN
+	}
+	return s.ProductName
+}
+
+// Matches reports if the history is for the product.  History without a TCIN is matched by name.
+func (s HistoricalStat) Matches(q ProductQuery) bool {
+	if s.TCIN != "" && q.TCIN != "" {
+		return s.TCIN == q.TCIN
+	}
+	return s.ProductName == q.Name
+}
+
+// HistoryKey is the Key of the product's history.
+func (q ProductQuery) HistoryKey() string {
+	return HistoricalStat{TCIN: q.TCIN, ProductName: q.Name}.Key()
+}
+
+// PartitionKey is the key of the partition holding samples taken at t.  Partitions are per UTC day.
+func PartitionKey(t time.Time) string {
+	return PartitionPrefix + t.UTC().Format(partitionLayout) + ".json"
+}
+
+// Overlaps reports if the partition may contain samples between from and to, inclusive.
+func (p PartitionRef) Overlaps(from, to int64) bool {
+	return p.Start <= to && p.End >= from
+}
+
+// MergeHistory joins the history of several partitions, in order, keeping samples between from and to inclusive.
+// Products keep the order in which they are first seen and the name they were last seen with, and products without
+// samples in the range are left out.
+func MergeHistory(partitions []HistoricalStats, from, to int64) []HistoricalStat {
+	merged := []HistoricalStat{}
+	index := map[string]int{}
+	for _, part := range partitions {
+		for _, stat := range part.History {
+			i, ok := index[stat.Key()]
+			if !ok {
+				i = len(merged)
+				index[stat.Key()] = i
+				merged = append(merged, HistoricalStat{TCIN: stat.TCIN, Data: []HistoricalData{}})
+			}
+			merged[i].ProductName = stat.ProductName
+			for _, d := range stat.Data {
+				if d.Time >= from && d.Time <= to {
+					merged[i].Data = append(merged[i].Data, d)
+				}
+			}
+		}
+	}
+	withData := []HistoricalStat{}
+	for _, stat := range merged {
+		if len(stat.Data) > 0 {
+			withData = append(withData, stat)
+		}
+	}
+	return withData
+}
@@ -0,0 +1,79 @@
+package schema
+
+// SummaryObjectKey is where the per-product availability summary is kept in the stats bucket.
+const SummaryObjectKey = "summary.json"
+
+// Summary is availability statistics for each product, computed from the raw history on every run so readers do not
+// have to.
+type Summary struct {
+	GeneratedAt int64 `json:"generated_at"`
+	// WindowSeconds is how far back the restock and drought statistics look.
+	WindowSeconds int64            `json:"window_seconds"`
+	Products      []ProductSummary `json:"products"`
+}
+
+// ProductSummary is the availability statistics for a single product.  A restock is a sample with stores after one
+// without, and a drought is a run of samples without stores.  Hours and days are in UTC, and fields that need at
+// least one restock are left out until there is one.
+type ProductSummary struct {
+	TCIN        string `json:"tcin"`
+	ProductName string `json:"product_name"`
+	// InStockPercent24h and InStockPercent7d are the percentage of samples with stores over the last day and week.
+	InStockPercent24h float64 `json:"in_stock_percent_24h"`
+	InStockPercent7d  float64 `json:"in_stock_percent_7d"`
+	Restocks          int     `json:"restocks"`
+	// AverageRestockIntervalSeconds is the mean time between restocks, which needs at least two.
+	AverageRestockIntervalSeconds int64 `json:"average_restock_interval_seconds,omitempty"`
+	// TypicalRestockHour is the hour of the day, 0 to 23, with the most restocks.
+	TypicalRestockHour *int `json:"typical_restock_hour,omitempty"`
+	// TypicalRestockWeekday is the day of the week, 0 (Sunday) to 6, with the most restocks.
+	TypicalRestockWeekday *int `json:"typical_restock_weekday,omitempty"`
+	// LongestDroughtSeconds is from the first sample without stores to the next sample with them, or to the last
+	// sample if the product is still out of stock.
+	LongestDroughtSeconds int64 `json:"longest_drought_seconds"`
+	LastInStock           int64 `json:"last_in_stock,omitempty"`
+	// LikelyRestock is the hour in the coming week when a restock has been most common, if there have been any.
+	LikelyRestock *ForecastWindow `json:"likely_restock,omitempty"`
+	// Forecast is the chance of the product being in stock in each of the coming hours.
+	Forecast []ForecastWindow `json:"forecast,omitempty"`
+	// Stores are the statistics for each store the product has been seen at, by store ID.
+	Stores []StoreSummary `json:"stores,omitempty"`
+}
+
+// StoreSummary is the availability statistics for a product at a single store.  Only samples that recorded stores
+// are counted.
+type StoreSummary struct {
+	StoreID        string  `json:"store_id"`
+	InStockPercent float64 `json:"in_stock_percent"`
+	Restocks       int     `json:"restocks"`
+	// MedianInStockSeconds is the median time from a restock to selling out, once the store has sold out after one.
+	MedianInStockSeconds int64 `json:"median_in_stock_seconds,omitempty"`
+	LastInStock          int64 `json:"last_in_stock,omitempty"`
+	// LikelyRestock and Forecast are the same as for the product, from the raw history at this store, so they are
+	// based on at most the summary window.
+	LikelyRestock *ForecastWindow  `json:"likely_restock,omitempty"`
+	Forecast      []ForecastWindow `json:"forecast,omitempty"`
+}
+
+// Key is the Key of the product's history.
+func (p ProductSummary) Key() string {
+	return HistoricalStat{TCIN: p.TCIN, ProductName: p.ProductName}.Key()
+}
+
+// Matches reports if the summary is for the product, the same as HistoricalStat.Matches.
+func (p ProductSummary) Matches(q ProductQuery) bool {
+	return HistoricalStat{TCIN: p.TCIN, ProductName: p.ProductName}.Matches(q)
+}
+
+// ForecastWindow is an estimate for the product in the window from Start to End, from the same hour of the week in
+// the hourly rollups, or in the raw history for a store.
+type ForecastWindow struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	// InStockProbability is the fraction of samples in this hour of the week with stores, from 0 to 1.
+	InStockProbability float64 `json:"in_stock_probability"`
+	// RestockProbability is the fraction of weeks with a restock in this hour of the week, from 0 to 1.
+	RestockProbability float64 `json:"restock_probability"`
+	// Weeks is how many weeks the estimate is based on.
+	Weeks int `json:"weeks"`
+}
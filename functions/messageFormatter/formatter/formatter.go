@@ -0,0 +1,272 @@
+package formatter
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/awsclient"
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/aws/aws-xray-sdk-go/xray"
+)
+
+const pickupTemplateName = "pickup_email"
+const shippingTemplateName = "shipping_email"
+
+const pickupEmailTpl string = `
+{{- if gt (len .) 0 -}}
+Product Alert!
+{{ range . -}}
+{{ .Name }}:
+{{ .ProductURL }}
+
+The following {{ .Result.Pickup.TotalStores }} stores claim to have at least ({{ .DesiredQuantity }}) available:
+{{ range topStores .Result.Pickup.Stores -}}
+{{ .LocationName }}
+	Available: {{ .AvailableToPromise }}
+	StoreID: {{ .StoreID }}
+	{{- if .Distance }}
+	Distance: {{ printf "%.1f" .Distance }} miles
+	{{- end }}
+	{{- with .MailingAddress }}
+	Address:
+		{{ .AddressLine1 }}
+		{{ .City }}
+		{{ .PostalCode }}
+		{{ .State }}
+	{{- end }}
+
+{{ end }}
+{{- with otherStores .Result.Pickup.Stores }}+{{ .Count }} more stores, {{ .Units }} units total
+
+{{ end }}
+{{- end -}}
+{{- end -}}
+{{- with restockHints -}}
+Likely restock times for products still out of stock:
+{{ range . }}{{ . }}
+{{ end }}
+{{- end -}}
+`
+
+const shippingEmailTpl string = `
+{{- if gt (len .) 0 -}}
+Product Alert!
+{{ range . -}}
+{{ .Name }} is available for online order.  {{ .Result.Shipping.AvailableToPromise }} available:
+{{ .ProductURL }}
+{{ end }}
+{{ end -}}
+{{- with restockHints -}}
+Likely restock times for products still out of stock:
+{{ range . }}{{ . }}
+{{ end }}
+{{- end -}}
+`
+
+// MessageResult contains formatted messages for both pickup and shipping information.
+// The SMS messages are compact versions of the same alerts for SMS subscribers.
+type MessageResult struct {
+	Pickup      string `json:"pickup"`
+	Shipping    string `json:"shipping"`
+	PickupSMS   string `json:"pickup_sms"`
+	ShippingSMS string `json:"shipping_sms"`
+}
+
+// Handler formats the alerts and notifies the webhook and push subscribers.  Create it with New.
+type Handler struct {
+	logger *log.Logger
+	client *http.Client
+	// notifyTimeout is how long a webhook or push call may take.
+	notifyTimeout time.Duration
+	subscriptions []WebhookSubscription
+	smsMaxLength  int
+	storeRanking  StoreRanking
+	// pushSubscriptions are notified when a product is back in stock, with a higher priority once it has been out of
+	// stock for escalateAfter.
+	pushSubscriptions []PushSubscription
+	escalateAfter     time.Duration
+	// statsAPI and statsBucket are where the Historical Stats function writes its objects.  The bucket is empty when
+	// there are none to read.
+	statsAPI    S3GetObjectAPI
+	statsBucket string
+	// templates is where user provided templates are read from.  When nil only the built-in templates are used.
+	templates        TemplateSource
+	pickupTemplate   *template.Template
+	shippingTemplate *template.Template
+}
+
+// New sets up a Handler with cfg, which logs to l.
+func New(l *log.Logger, cfg Config) *Handler {
+	h := &Handler{
+		logger:            l,
+		client:            &http.Client{Timeout: cfg.NotifyTimeout},
+		notifyTimeout:     cfg.NotifyTimeout,
+		subscriptions:     cfg.Webhooks,
+		smsMaxLength:      cfg.SMSMaxLength,
+		storeRanking:      cfg.StoreRanking,
+		pushSubscriptions: cfg.PushSubscriptions,
+		escalateAfter:     cfg.EscalateAfter,
+	}
+	var s3APIClient S3GetObjectAPI
+	s3Client, err := awsclient.S3(context.Background(), l)
+	if err != nil {
+		l.Printf("unable to configure S3, templates and stats will not be read from S3: %s\n", err)
+	} else {
+		s3APIClient = s3Client
+	}
+	h.statsAPI, h.statsBucket = h.configureStatsSource(cfg, s3APIClient)
+	h.templates = h.configureTemplateSource(cfg, s3APIClient)
+	h.prepareTemplates()
+	return h
+}
+
+// Trace records the webhook and push calls with X-Ray.
+func (h *Handler) Trace() {
+	h.client = xray.Client(h.client)
+}
+
+// Handle formats the alerts for the products available for pickup and shipping, with restock hints for the products
+// still out of stock, and notifies the webhook and push subscribers.
+func (h *Handler) Handle(ctx context.Context, input schema.ProductsInput) (MessageResult, error) {
+	h.logger.Printf("input: %+v\n", input)
+	availableInStore := []schema.Product{}
+	availableShipping := []schema.Product{}
+	result := MessageResult{}
+	for _, p := range input.Products {
+		if p.Result.Pickup.TotalStores > 0 {
+			availableInStore = append(availableInStore, p)
+		}
+		if p.Result.Shipping.IsAvailable {
+			availableShipping = append(availableShipping, p)
+		}
+	}
+	h.logger.Printf("creating in-store pickup message for %d products\n", len(availableInStore))
+	h.logger.Printf("creating shipping pickup message for %d products\n", len(availableShipping))
+	now := time.Now()
+	if len(availableInStore) > 0 || len(availableShipping) > 0 {
+		h.notifyWebhooks(ctx, availableInStore, availableShipping)
+		if len(h.pushSubscriptions) > 0 {
+			h.notifyNewlyAvailable(ctx, input.Products, now)
+		}
+	}
+	// the hints are sent even when nothing is available, as that is when they are most useful
+	summary := h.loadSummaryOrNil(ctx)
+	pickupHints := alertHints(summary, input.Products, availableInStore, now)
+	shippingHints := alertHints(summary, input.Products, availableShipping, now)
+	pickupMessage, err := executeTemplate(h.pickupTemplate, availableInStore, hintLines(pickupHints))
+	if err != nil {
+		return result, err
+	}
+	shippingMessage, err := executeTemplate(h.shippingTemplate, availableShipping, hintLines(shippingHints))
+	if err != nil {
+		return result, err
+	}
+	result.Pickup = pickupMessage
+	result.Shipping = shippingMessage
+	result.PickupSMS = formatPickupSMS(availableInStore, h.smsMaxLength)
+	if len(availableInStore) == 0 {
+		result.PickupSMS = formatRestockSMS(pickupHints, h.smsMaxLength)
+	}
+	result.ShippingSMS = formatShippingSMS(availableShipping, h.smsMaxLength)
+	if len(availableShipping) == 0 {
+		result.ShippingSMS = formatRestockSMS(shippingHints, h.smsMaxLength)
+	}
+	return result, nil
+}
+
+// Config is the configuration of the formatter.
+type Config struct {
+	// Stats is where the objects written by the Historical Stats function are read from, with StatsBucket as the
+	// bucket.  When it is nil, New reads them from StatsDir if it is set, or else from StatsBucket in S3.
+	Stats       S3GetObjectAPI
+	StatsBucket string
+	StatsDir    string
+	// TemplateDir, or else TemplateBucket under TemplatePrefix, holds templates in place of the built-ins.
+	TemplateDir    string
+	TemplateBucket string
+	TemplatePrefix string
+	NotifyTimeout  time.Duration
+	Webhooks       []WebhookSubscription
+	SMSMaxLength   int
+	StoreRanking   StoreRanking
+	// PushSubscriptions are notified when a product is back in stock, with a higher priority once it has been out of
+	// stock for EscalateAfter.
+	PushSubscriptions []PushSubscription
+	EscalateAfter     time.Duration
+}
+
+// LoadConfig reads the configuration of the formatter from the environment.  A setting that cannot be read is logged
+// to l and its default is used, so a bad setting never stops the alerts.
+func LoadConfig(l *log.Logger) Config {
+	cfg := Config{
+		StatsBucket:    os.Getenv(statsBucketEnv),
+		StatsDir:       os.Getenv(statsDirEnv),
+		TemplateDir:    os.Getenv(templateDirEnv),
+		TemplateBucket: os.Getenv(templateBucketEnv),
+		TemplatePrefix: os.Getenv(templatePrefixEnv),
+	}
+	var err error
+	if cfg.NotifyTimeout, err = loadNotifyTimeout(); err != nil {
+		l.Printf("invalid %s, using %s: %s\n", notifyTimeoutEnv, defaultNotifyTimeout, err)
+		cfg.NotifyTimeout = defaultNotifyTimeout
+	}
+	if cfg.Webhooks, err = loadWebhookSubscriptions(); err != nil {
+		l.Printf("invalid %s, no webhooks will be notified: %s\n", webhookSubscriptionsEnv, err)
+	}
+	if cfg.SMSMaxLength, err = loadSMSMaxLength(); err != nil {
+		l.Printf("invalid %s, using %d: %s\n", smsMaxLengthEnv, defaultSMSMaxLength, err)
+		cfg.SMSMaxLength = defaultSMSMaxLength
+	}
+	if cfg.StoreRanking, err = loadStoreRanking(); err != nil {
+		l.Printf("invalid store ranking, using the default: %s\n", err)
+		cfg.StoreRanking = defaultStoreRanking
+	}
+	if cfg.PushSubscriptions, cfg.EscalateAfter, err = loadPushConfig(); err != nil {
+		l.Printf("invalid push configuration, no push notifications will be sent: %s\n", err)
+		cfg.EscalateAfter = defaultEscalateAfter
+	}
+	return cfg
+}
+
+// prepareTemplates loads the message templates from the configured TemplateSource, falling back to the built-ins.
+func (h *Handler) prepareTemplates() {
+	ctx := context.Background()
+	h.pickupTemplate = h.loadTemplate(ctx, pickupTemplateName, pickupEmailTpl)
+	h.shippingTemplate = h.loadTemplate(ctx, shippingTemplateName, shippingEmailTpl)
+}
+
+func (h *Handler) configureTemplateSource(cfg Config, api S3GetObjectAPI) TemplateSource {
+	if cfg.TemplateDir != "" {
+		h.logger.Printf("Template directory found: %s\n", cfg.TemplateDir)
+		return DirTemplateSource(cfg.TemplateDir)
+	}
+	if cfg.TemplateBucket != "" && api != nil {
+		h.logger.Printf("Template bucket found: %s\n", cfg.TemplateBucket)
+		return S3TemplateSource{API: api, Bucket: cfg.TemplateBucket, Prefix: cfg.TemplatePrefix}
+	}
+	return nil
+}
+
+// executeTemplate renders a copy of t with the restockHints for this call, so the shared template is never executed
+// and can be copied again by the next call.
+func executeTemplate(t *template.Template, input any, hints []string) (string, error) {
+	t, err := t.Clone()
+	if err != nil {
+		return "", err
+	}
+	t.Funcs(template.FuncMap{
+		"restockHints": func() []string {
+			return hints
+		},
+	})
+	buf := bytes.NewBuffer(make([]byte, 0))
+	if err := t.Execute(buf, input); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
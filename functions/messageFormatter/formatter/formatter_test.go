@@ -1,13 +1,28 @@
-package main
+package formatter
 
 import (
 	"context"
 	"log"
+	"net/http"
 	"testing"
 
 	"github.com/akijowski/target-tracker/internal/schema"
 )
 
+// testHandler is a Handler with the default settings and the built-in templates.
+func testHandler() *Handler {
+	h := &Handler{
+		logger:        log.Default(),
+		client:        &http.Client{Timeout: defaultNotifyTimeout},
+		notifyTimeout: defaultNotifyTimeout,
+		smsMaxLength:  defaultSMSMaxLength,
+		storeRanking:  defaultStoreRanking,
+		escalateAfter: defaultEscalateAfter,
+	}
+	h.prepareTemplates()
+	return h
+}
+
 func TestHandler(t *testing.T) {
 	cases := map[string]struct {
 		input    schema.ProductsInput
@@ -83,10 +98,8 @@ Denver
 
 	for name, tt := range cases {
 		t.Run(name, func(t *testing.T) {
-			logger = log.Default()
 			ctx := context.Background()
-			prepareTemplates()
-			actual, err := handler(ctx, tt.input)
+			actual, err := testHandler().Handle(ctx, tt.input)
 
 			if err != nil {
 				t.Fatalf("unexpected error: %s", err)
@@ -175,10 +188,8 @@ url-to-other-formula
 
 	for name, tt := range cases {
 		t.Run(name, func(t *testing.T) {
-			logger = log.Default()
 			ctx := context.Background()
-			prepareTemplates()
-			actual, err := handler(ctx, tt.input)
+			actual, err := testHandler().Handle(ctx, tt.input)
 
 			if err != nil {
 				t.Fatalf("unexpected error: %s", err)
@@ -193,3 +204,44 @@ url-to-other-formula
 		})
 	}
 }
+
+func TestNew(t *testing.T) {
+	cases := map[string]struct {
+		env map[string]string
+	}{
+		"Defaults": {},
+		"Invalid settings use the defaults": {
+			env: map[string]string{
+				webhookSubscriptionsEnv: `[{"platform": "myspace"}]`,
+				smsMaxLengthEnv:         "1000",
+				storeSortEnv:            "price",
+				pushSubscriptionsEnv:    "{",
+				pushEscalateAfterEnv:    "1d",
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("AWS_REGION", "us-east-2")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			h := New(log.Default(), LoadConfig(log.Default()))
+
+			if len(h.subscriptions) != 0 || len(h.pushSubscriptions) != 0 {
+				t.Errorf("expected no subscriptions, got %+v and %+v", h.subscriptions, h.pushSubscriptions)
+			}
+			if h.smsMaxLength != defaultSMSMaxLength || h.storeRanking != defaultStoreRanking || h.escalateAfter != defaultEscalateAfter {
+				t.Errorf("expected the defaults, got %d, %+v and %s", h.smsMaxLength, h.storeRanking, h.escalateAfter)
+			}
+			if h.notifyTimeout != defaultNotifyTimeout || h.client.Timeout != defaultNotifyTimeout {
+				t.Errorf("expected the default timeout, got %s and %s", h.notifyTimeout, h.client.Timeout)
+			}
+			if h.pickupTemplate == nil || h.shippingTemplate == nil {
+				t.Error("expected the built-in templates")
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package formatter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	statsBucketEnv = "STATS_BUCKET_NAME"
+	statsDirEnv    = "STATS_DIR"
+	// Historical Stats runs in parallel with this function, so samples this recent may already be from the current run.
+	currentRunWindow = 10 * time.Minute
+)
+
+// DirStatsObjects reads the stats objects kept under a local directory by the Historical Stats function, with the key
+// as the path.  The bucket of each request is ignored.
+type DirStatsObjects string
+
+func (d DirStatsObjects) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	b, err := os.ReadFile(filepath.Join(string(d), filepath.FromSlash(aws.ToString(params.Key))))
+	if err != nil {
+		return nil, err
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(b))}, nil
+}
+
+// configureStatsSource reads the stats from the Stats of cfg when it is set, from its StatsDir when that is set, or
+// else from its StatsBucket when there is an S3 client.
+func (h *Handler) configureStatsSource(cfg Config, api S3GetObjectAPI) (S3GetObjectAPI, string) {
+	if cfg.Stats != nil {
+		return cfg.Stats, cfg.StatsBucket
+	}
+	if cfg.StatsDir != "" {
+		h.logger.Printf("Stats directory found: %s\n", cfg.StatsDir)
+		// the directory stands in for the bucket, so the stats are read as if there is one
+		return DirStatsObjects(cfg.StatsDir), cfg.StatsDir
+	}
+	if api == nil {
+		return nil, ""
+	}
+	return api, cfg.StatsBucket
+}
+
+// loadHistory reads the history between from and to written by the Historical Stats function.  Only the partitions
+// listed in the stats index that overlap the range are fetched.
+func loadHistory(ctx context.Context, api S3GetObjectAPI, bucketName string, from, to time.Time) (*schema.HistoricalStats, error) {
+	b, err := getStatsObject(ctx, api, bucketName, schema.StatsObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	var index schema.StatsIndex
+	if err := json.Unmarshal(b, &index); err != nil {
+		return nil, err
+	}
+	hs := &schema.HistoricalStats{CreatedAt: index.CreatedAt, LastUpdatedAt: index.LastUpdatedAt}
+	if len(index.Partitions) == 0 {
+		// stats written before history was partitioned keep every sample in the index object
+		if err := json.Unmarshal(b, hs); err != nil {
+			return nil, err
+		}
+		hs.History = schema.MergeHistory([]schema.HistoricalStats{*hs}, from.Unix(), to.Unix())
+		return hs, nil
+	}
+	partitions := []schema.HistoricalStats{}
+	for _, ref := range index.Partitions {
+		if !ref.Overlaps(from.Unix(), to.Unix()) {
+			continue
+		}
+		b, err := getStatsObject(ctx, api, bucketName, ref.Key)
+		if err != nil {
+			return nil, err
+		}
+		var part schema.HistoricalStats
+		if err := json.Unmarshal(b, &part); err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, part)
+	}
+	hs.History = schema.MergeHistory(partitions, from.Unix(), to.Unix())
+	return hs, nil
+}
+
+func getStatsObject(ctx context.Context, api S3GetObjectAPI, bucketName, key string) ([]byte, error) {
+	out, err := api.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+// ProductHistory is what the stats say about a product before the current run.
+type ProductHistory struct {
+	// Known is false when there are no samples for the product.
+	Known bool
+	// InStock is true when the product was available in the most recent sample, at a store or for shipping.
+	InStock bool
+	// OutOfStockSince is the first sample after the product was last available.
+	// If it was never in stock, this is the first sample.
+	OutOfStockSince time.Time
+}
+
+// previousHistory finds the history for the product, ignoring samples that may be from the current run.
+func previousHistory(stats *schema.HistoricalStats, p schema.Product, now time.Time) ProductHistory {
+	h := ProductHistory{}
+	if stats == nil {
+		return h
+	}
+	cutoff := now.Add(-currentRunWindow).Unix()
+	for _, stat := range stats.History {
+		if !stat.Matches(p.ProductQuery) {
+			continue
+		}
+		for _, d := range stat.Data {
+			if d.Time >= cutoff {
+				continue
+			}
+			if !h.Known || (h.InStock && !d.Available()) {
+				h.OutOfStockSince = time.Unix(d.Time, 0)
+			}
+			h.Known = true
+			h.InStock = d.Available()
+		}
+	}
+	return h
+}
@@ -0,0 +1,109 @@
+package formatter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestConfigureStatsSource(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "history"), 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	index := schema.StatsIndex{Partitions: []schema.PartitionRef{{Key: "history/2022-06-01.json", Start: 100, End: 200}}}
+	part := schema.HistoricalStats{History: []schema.HistoricalStat{{ProductName: "formula", Data: []schema.HistoricalData{{Time: 150, Count: 1}}}}}
+	for key, v := range map[string]interface{}{schema.StatsObjectKey: index, index.Partitions[0].Key: part} {
+		b, _ := json.Marshal(v)
+		if err := os.WriteFile(filepath.Join(dir, key), b, 0o644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	api, bucket := testHandler().configureStatsSource(Config{StatsBucket: "bucket", StatsDir: dir}, nil)
+	actual, err := loadHistory(context.Background(), api, bucket, time.Unix(100, 0), time.Unix(200, 0))
+
+	if err != nil || actual == nil || len(actual.History) != 1 || !reflect.DeepEqual(actual.History[0].Data, part.History[0].Data) {
+		t.Errorf("wanted %+v, got %+v", part.History, actual)
+	}
+}
+
+func TestLoadHistory(t *testing.T) {
+	partition := func(times ...int64) schema.HistoricalStats {
+		data := []schema.HistoricalData{}
+		for _, tm := range times {
+			data = append(data, schema.HistoricalData{Time: tm, Count: 1})
+		}
+		return schema.HistoricalStats{History: []schema.HistoricalStat{{ProductName: "formula", Data: data}}}
+	}
+	cases := map[string]struct {
+		objects      map[string]interface{}
+		from, to     int64
+		expected     []schema.HistoricalData
+		expectedGets int
+	}{
+		"Only overlapping partitions are read": {
+			objects: map[string]interface{}{
+				schema.StatsObjectKey: schema.StatsIndex{Partitions: []schema.PartitionRef{
+					{Key: "day-1", Start: 10, End: 20},
+					{Key: "day-2", Start: 30, End: 40},
+					{Key: "day-3", Start: 50, End: 60},
+				}},
+				"day-1": partition(10, 20),
+				"day-2": partition(30, 40),
+				"day-3": partition(50, 60),
+			},
+			from:         35,
+			to:           55,
+			expected:     []schema.HistoricalData{{Time: 40, Count: 1}, {Time: 50, Count: 1}},
+			expectedGets: 3,
+		},
+		"Stats from before partitioning are read from the index": {
+			objects: map[string]interface{}{
+				schema.StatsObjectKey: partition(10, 20, 30),
+			},
+			from:         15,
+			to:           30,
+			expected:     []schema.HistoricalData{{Time: 20, Count: 1}, {Time: 30, Count: 1}},
+			expectedGets: 1,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			gets := 0
+			api := mockS3GetObjectAPI(func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+				gets++
+				v, ok := tt.objects[aws.ToString(params.Key)]
+				if !ok {
+					t.Fatalf("unexpected key: %s", aws.ToString(params.Key))
+				}
+				b, err := json.Marshal(v)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(b))}, nil
+			})
+
+			actual, err := loadHistory(context.Background(), api, "bucket", time.Unix(tt.from, 0), time.Unix(tt.to, 0))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(actual.History) != 1 || !reflect.DeepEqual(actual.History[0].Data, tt.expected) {
+				t.Errorf("wanted %+v, got %+v", tt.expected, actual.History)
+			}
+			if gets != tt.expectedGets {
+				t.Errorf("expected %d reads, got %d", tt.expectedGets, gets)
+			}
+		})
+	}
+}
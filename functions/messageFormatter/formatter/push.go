@@ -0,0 +1,209 @@
+package formatter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+const (
+	pushSubscriptionsEnv = "PUSH_SUBSCRIPTIONS"
+	pushEscalateAfterEnv = "PUSH_ESCALATE_AFTER"
+	serviceNtfy          = "ntfy"
+	servicePushover      = "pushover"
+	pushoverURL          = "https://api.pushover.net/1/messages.json"
+	// Products out of stock for this long are sent with high priority, and urgent at 3x.
+	defaultEscalateAfter = 24 * time.Hour
+)
+
+// PushPriority is a service neutral notification priority.
+type PushPriority int
+
+const (
+	PriorityDefault PushPriority = iota
+	PriorityHigh
+	PriorityUrgent
+)
+
+// PushSubscription is a push notification service that should receive an alert per newly available product.
+// For ntfy, URL is the topic URL (e.g. https://ntfy.sh/formula) and Token is an optional access token.
+// For Pushover, Token is the application token and User is the user or group key.
+type PushSubscription struct {
+	Service string `json:"service"`
+	URL     string `json:"url"`
+	Token   string `json:"token"`
+	User    string `json:"user"`
+}
+
+// PushNotification is a single product alert.
+type PushNotification struct {
+	Title    string
+	Message  string
+	URL      string
+	Priority PushPriority
+}
+
+// loadPushConfig reads the push subscriptions and escalation threshold from the environment.
+func loadPushConfig() ([]PushSubscription, time.Duration, error) {
+	after := defaultEscalateAfter
+	if raw := os.Getenv(pushEscalateAfterEnv); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, 0, err
+		}
+		after = d
+	}
+	raw := os.Getenv(pushSubscriptionsEnv)
+	if raw == "" {
+		return nil, after, nil
+	}
+	var subs []PushSubscription
+	if err := json.Unmarshal([]byte(raw), &subs); err != nil {
+		return nil, 0, err
+	}
+	for i, s := range subs {
+		switch s.Service {
+		case serviceNtfy:
+			if s.URL == "" {
+				return nil, 0, fmt.Errorf("ntfy subscription requires a topic url")
+			}
+		case servicePushover:
+			if s.Token == "" || s.User == "" {
+				return nil, 0, fmt.Errorf("pushover subscription requires a token and user")
+			}
+			if s.URL == "" {
+				subs[i].URL = pushoverURL
+			}
+		default:
+			return nil, 0, fmt.Errorf("unknown push service: %q", s.Service)
+		}
+	}
+	return subs, after, nil
+}
+
+// notifyNewlyAvailable sends a push notification for each product that became available in this run.  Without the
+// history every available product would look new, so nothing is sent when it cannot be read.
+func (h *Handler) notifyNewlyAvailable(ctx context.Context, products []schema.Product, now time.Time) {
+	if h.statsAPI == nil || h.statsBucket == "" {
+		h.logger.Println("no historical stats to tell which products are newly available, not sending push notifications")
+		return
+	}
+	// an urgent push needs an outage of 3x escalateAfter, so there is no need to read further back than that
+	stats, err := loadHistory(ctx, h.statsAPI, h.statsBucket, now.Add(-3*h.escalateAfter-time.Hour), now)
+	if err != nil {
+		h.logger.Printf("unable to load historical stats, not sending push notifications: %s\n", err)
+		return
+	}
+	h.notifyPush(ctx, newlyAvailable(products, stats, now, h.escalateAfter))
+}
+
+// newlyAvailable builds a notification for each available product that was not available before this run.
+// Products with no history are treated as newly available.
+func newlyAvailable(products []schema.Product, stats *schema.HistoricalStats, now time.Time, escalate time.Duration) []PushNotification {
+	notifications := []PushNotification{}
+	for _, p := range products {
+		if !p.Result.Available() {
+			continue
+		}
+		h := previousHistory(stats, p, now)
+		if h.Known && h.InStock {
+			continue
+		}
+		n := PushNotification{
+			Title:    fmt.Sprintf("%s is available", p.Name),
+			Message:  pushMessage(p),
+			URL:      p.ProductURL,
+			Priority: PriorityDefault,
+		}
+		if h.Known {
+			outage := now.Sub(h.OutOfStockSince)
+			switch {
+			case outage >= 3*escalate:
+				n.Priority = PriorityUrgent
+			case outage >= escalate:
+				n.Priority = PriorityHigh
+			}
+			n.Message += fmt.Sprintf("\nOut of stock for %s", outage.Round(time.Hour))
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications
+}
+
+func pushMessage(p schema.Product) string {
+	parts := []string{}
+	if p.Result.Pickup.TotalStores > 0 {
+		parts = append(parts, fmt.Sprintf("In store at %d stores", p.Result.Pickup.TotalStores))
+	}
+	if p.Result.Shipping.IsAvailable {
+		parts = append(parts, fmt.Sprintf("%d available online", p.Result.Shipping.AvailableToPromise))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// notifyPush sends every notification to every push subscription.
+// Failures are logged rather than returned so one broken service does not block the other alerts.
+func (h *Handler) notifyPush(ctx context.Context, notifications []PushNotification) {
+	for _, s := range h.pushSubscriptions {
+		for _, n := range notifications {
+			var err error
+			switch s.Service {
+			case serviceNtfy:
+				err = h.sendNtfy(ctx, s, n)
+			case servicePushover:
+				err = h.sendPushover(ctx, s, n)
+			}
+			if err != nil {
+				h.logger.Printf("unable to send %s push notification for %s: %s\n", s.Service, n.Title, err)
+			}
+		}
+	}
+}
+
+func (h *Handler) sendNtfy(ctx context.Context, s PushSubscription, n PushNotification) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, strings.NewReader(n.Message))
+	if err != nil {
+		return err
+	}
+	priority := map[PushPriority]string{PriorityDefault: "3", PriorityHigh: "4", PriorityUrgent: "5"}[n.Priority]
+	tags := map[PushPriority]string{PriorityDefault: "shopping_cart", PriorityHigh: "shopping_cart,warning", PriorityUrgent: "shopping_cart,rotating_light"}[n.Priority]
+	req.Header.Set("Title", n.Title)
+	req.Header.Set("Priority", priority)
+	req.Header.Set("Tags", tags)
+	req.Header.Set("Click", n.URL)
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	return h.doRequest(req)
+}
+
+func (h *Handler) sendPushover(ctx context.Context, s PushSubscription, n PushNotification) error {
+	form := url.Values{}
+	form.Set("token", s.Token)
+	form.Set("user", s.User)
+	form.Set("title", n.Title)
+	form.Set("message", n.Message)
+	form.Set("url", n.URL)
+	form.Set("url_title", "View Product")
+	priority := map[PushPriority]int{PriorityDefault: 0, PriorityHigh: 1, PriorityUrgent: 2}[n.Priority]
+	form.Set("priority", strconv.Itoa(priority))
+	if n.Priority == PriorityUrgent {
+		// Emergency priority repeats until acknowledged and requires a retry interval and expiry
+		form.Set("retry", "300")
+		form.Set("expire", "3600")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return h.doRequest(req)
+}
@@ -0,0 +1,199 @@
+package formatter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestNewlyAvailable(t *testing.T) {
+	now := time.Now()
+	hoursAgo := func(h int) int64 { return now.Add(time.Duration(-h) * time.Hour).Unix() }
+	inStore := schema.Product{
+		ProductQuery: schema.ProductQuery{Name: "formula", ProductURL: "url-to-formula"},
+		Result:       schema.ProductResult{Pickup: schema.PickupResult{TotalStores: 2}},
+	}
+	shipping := schema.Product{
+		ProductQuery: schema.ProductQuery{Name: "formula", ProductURL: "url-to-formula"},
+		Result:       schema.ProductResult{Shipping: schema.ShippingResult{IsAvailable: true, AvailableToPromise: 4}},
+	}
+	cases := map[string]struct {
+		products []schema.Product
+		history  []schema.HistoricalData
+		expected []PushPriority
+	}{
+		"Unavailable product is not sent": {
+			products: []schema.Product{{ProductQuery: schema.ProductQuery{Name: "formula"}}},
+			expected: []PushPriority{},
+		},
+		"Product without history is sent": {
+			products: []schema.Product{inStore},
+			expected: []PushPriority{PriorityDefault},
+		},
+		"Product already in stock is not sent": {
+			products: []schema.Product{inStore},
+			history:  []schema.HistoricalData{{Time: hoursAgo(2), Count: 0}, {Time: hoursAgo(1), Count: 3}},
+			expected: []PushPriority{},
+		},
+		"Sample from the current run is ignored": {
+			products: []schema.Product{inStore},
+			history:  []schema.HistoricalData{{Time: hoursAgo(1), Count: 0}, {Time: now.Unix(), Count: 2}},
+			expected: []PushPriority{PriorityDefault},
+		},
+		"Short outage has default priority": {
+			products: []schema.Product{inStore},
+			history:  []schema.HistoricalData{{Time: hoursAgo(3), Count: 1}, {Time: hoursAgo(2), Count: 0}, {Time: hoursAgo(1), Count: 0}},
+			expected: []PushPriority{PriorityDefault},
+		},
+		"Long outage has high priority": {
+			products: []schema.Product{inStore},
+			history:  []schema.HistoricalData{{Time: hoursAgo(30), Count: 1}, {Time: hoursAgo(25), Count: 0}, {Time: hoursAgo(1), Count: 0}},
+			expected: []PushPriority{PriorityHigh},
+		},
+		"Product already shipping is not sent": {
+			products: []schema.Product{shipping},
+			history:  []schema.HistoricalData{{Time: hoursAgo(2), Count: 0}, {Time: hoursAgo(1), Count: 0, ShippingAvailable: true}},
+			expected: []PushPriority{},
+		},
+		"Product no longer shipping is sent": {
+			products: []schema.Product{shipping},
+			history:  []schema.HistoricalData{{Time: hoursAgo(2), Count: 0, ShippingAvailable: true}, {Time: hoursAgo(1), Count: 0}},
+			expected: []PushPriority{PriorityDefault},
+		},
+		"Very long outage is urgent": {
+			products: []schema.Product{inStore},
+			history:  []schema.HistoricalData{{Time: hoursAgo(100), Count: 0}, {Time: hoursAgo(1), Count: 0}},
+			expected: []PushPriority{PriorityUrgent},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			stats := &schema.HistoricalStats{}
+			if tt.history != nil {
+				stats.History = []schema.HistoricalStat{{ProductName: "formula", Data: tt.history}}
+			}
+			actual := newlyAvailable(tt.products, stats, now, 24*time.Hour)
+			if len(actual) != len(tt.expected) {
+				t.Fatalf("expected %d notifications, got %d: %+v", len(tt.expected), len(actual), actual)
+			}
+			for i, n := range actual {
+				if n.Priority != tt.expected[i] {
+					t.Errorf("expected priority %d, got %d", tt.expected[i], n.Priority)
+				}
+				if n.URL != "url-to-formula" {
+					t.Errorf("expected click through to product, got %s", n.URL)
+				}
+			}
+		})
+	}
+}
+
+func TestNotifyNewlyAvailable(t *testing.T) {
+	inStore := schema.Product{
+		ProductQuery: schema.ProductQuery{Name: "formula", ProductURL: "url-to-formula"},
+		Result:       schema.ProductResult{Pickup: schema.PickupResult{TotalStores: 2}},
+	}
+	cases := map[string]struct {
+		api      S3GetObjectAPI
+		bucket   string
+		expected int
+	}{
+		"New product is sent": {
+			api: mockS3GetObjectAPI(func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+				return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(`{"partitions": []}`))}, nil
+			}),
+			bucket:   "bucket",
+			expected: 1,
+		},
+		"Nothing is sent when the history cannot be read": {
+			api: mockS3GetObjectAPI(func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+				return nil, errors.New("access denied")
+			}),
+			bucket: "bucket",
+		},
+		"Nothing is sent without a stats bucket": {},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			requests := 0
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+			}))
+			defer mockServer.Close()
+			h := testHandler()
+			h.pushSubscriptions = []PushSubscription{{Service: serviceNtfy, URL: mockServer.URL}}
+			h.statsAPI, h.statsBucket = tt.api, tt.bucket
+
+			h.notifyNewlyAvailable(context.Background(), []schema.Product{inStore}, time.Now())
+
+			if requests != tt.expected {
+				t.Errorf("expected %d notifications, got %d", tt.expected, requests)
+			}
+		})
+	}
+}
+
+func TestNotifyPush(t *testing.T) {
+	notification := PushNotification{Title: "formula is available", Message: "In store at 2 stores", URL: "url-to-formula", Priority: PriorityUrgent}
+	cases := map[string]struct {
+		sub      PushSubscription
+		validate func(t *testing.T, r *http.Request)
+	}{
+		"ntfy uses headers": {
+			sub: PushSubscription{Service: serviceNtfy, Token: "tk"},
+			validate: func(t *testing.T, r *http.Request) {
+				if r.Header.Get("Priority") != "5" || r.Header.Get("Click") != "url-to-formula" || r.Header.Get("Title") != "formula is available" {
+					t.Errorf("unexpected headers: %v", r.Header)
+				}
+				if r.Header.Get("Authorization") != "Bearer tk" {
+					t.Errorf("expected bearer token, got %s", r.Header.Get("Authorization"))
+				}
+			},
+		},
+		"pushover uses form values": {
+			sub: PushSubscription{Service: servicePushover, Token: "app", User: "user"},
+			validate: func(t *testing.T, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if r.PostForm.Get("priority") != "2" || r.PostForm.Get("retry") == "" || r.PostForm.Get("expire") == "" {
+					t.Errorf("expected emergency priority, got %v", r.PostForm)
+				}
+				if r.PostForm.Get("url") != "url-to-formula" || r.PostForm.Get("token") != "app" || r.PostForm.Get("user") != "user" {
+					t.Errorf("unexpected form: %v", r.PostForm)
+				}
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			requests := 0
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				tt.validate(t, r)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer mockServer.Close()
+
+			tt.sub.URL = mockServer.URL
+			h := testHandler()
+			h.pushSubscriptions = []PushSubscription{tt.sub}
+			h.notifyPush(context.Background(), []PushNotification{notification})
+
+			if requests != 1 {
+				t.Errorf("expected 1 request, got %d", requests)
+			}
+		})
+	}
+}
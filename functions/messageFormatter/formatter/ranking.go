@@ -0,0 +1,162 @@
+package formatter
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+const (
+	storeSortEnv           = "STORE_SORT"
+	storeLimitEnv          = "STORE_LIMIT"
+	storeDistanceWeightEnv = "STORE_DISTANCE_WEIGHT"
+	sortByDistance         = "distance"
+	sortByQuantity         = "quantity"
+	sortByScore            = "score"
+	defaultStoreLimit      = 5
+	defaultDistanceWeight  = 0.5
+)
+
+var defaultStoreRanking = StoreRanking{SortBy: sortByDistance, Limit: defaultStoreLimit, DistanceWeight: defaultDistanceWeight}
+
+// StoreRanking orders the stores for a product and decides how many are listed in an alert.
+// A Limit of 0 lists every store.
+type StoreRanking struct {
+	SortBy string
+	Limit  int
+	// DistanceWeight is how much the score favours nearby stores (1) over stores with more available (0).
+	DistanceWeight float64
+}
+
+// StoreSummary describes the stores left out of an alert.
+type StoreSummary struct {
+	Count int
+	Units int
+}
+
+// loadStoreRanking reads the store ranking from the environment.
+func loadStoreRanking() (StoreRanking, error) {
+	r := defaultStoreRanking
+	if raw := os.Getenv(storeSortEnv); raw != "" {
+		switch raw {
+		case sortByDistance, sortByQuantity, sortByScore:
+			r.SortBy = raw
+		default:
+			return r, fmt.Errorf("unknown store sort: %q", raw)
+		}
+	}
+	if raw := os.Getenv(storeLimitEnv); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return r, err
+		}
+		if n < 0 {
+			return r, fmt.Errorf("%s cannot be negative", storeLimitEnv)
+		}
+		r.Limit = n
+	}
+	if raw := os.Getenv(storeDistanceWeightEnv); raw != "" {
+		w, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return r, err
+		}
+		if w < 0 || w > 1 {
+			return r, fmt.Errorf("%s must be between 0 and 1", storeDistanceWeightEnv)
+		}
+		r.DistanceWeight = w
+	}
+	return r, nil
+}
+
+// Rank returns a sorted copy of stores.  Ties are broken by distance, then quantity, then StoreID so the order is
+// always the same for the same input.
+func (r StoreRanking) Rank(stores []schema.StoreResult) []schema.StoreResult {
+	ranked := make([]schema.StoreResult, len(stores))
+	copy(ranked, stores)
+	maxDistance, maxQuantity := 0.0, 0
+	for _, s := range stores {
+		if s.Distance > maxDistance {
+			maxDistance = s.Distance
+		}
+		if s.AvailableToPromise > maxQuantity {
+			maxQuantity = s.AvailableToPromise
+		}
+	}
+	score := func(s schema.StoreResult) float64 {
+		near, plenty := 1.0, 1.0
+		if maxDistance > 0 {
+			near = 1 - s.Distance/maxDistance
+		}
+		if maxQuantity > 0 {
+			plenty = float64(s.AvailableToPromise) / float64(maxQuantity)
+		}
+		return r.DistanceWeight*near + (1-r.DistanceWeight)*plenty
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		switch r.SortBy {
+		case sortByQuantity:
+			if a.AvailableToPromise != b.AvailableToPromise {
+				return a.AvailableToPromise > b.AvailableToPromise
+			}
+		case sortByScore:
+			if sa, sb := score(a), score(b); sa != sb {
+				return sa > sb
+			}
+		}
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		if a.AvailableToPromise != b.AvailableToPromise {
+			return a.AvailableToPromise > b.AvailableToPromise
+		}
+		return a.StoreID < b.StoreID
+	})
+	return ranked
+}
+
+// Top returns the highest ranked stores, at most Limit of them.
+func (r StoreRanking) Top(stores []schema.StoreResult) []schema.StoreResult {
+	ranked := r.Rank(stores)
+	if r.Limit > 0 && len(ranked) > r.Limit {
+		return ranked[:r.Limit]
+	}
+	return ranked
+}
+
+// Rest summarizes the stores not returned by Top.  It is nil when every store is listed.
+func (r StoreRanking) Rest(stores []schema.StoreResult) *StoreSummary {
+	if r.Limit == 0 || len(stores) <= r.Limit {
+		return nil
+	}
+	summary := &StoreSummary{}
+	for _, s := range r.Rank(stores)[r.Limit:] {
+		summary.Count++
+		summary.Units += s.AvailableToPromise
+	}
+	return summary
+}
+
+func (s StoreSummary) String() string {
+	return fmt.Sprintf("+%d more stores, %d units total", s.Count, s.Units)
+}
+
+// templateFuncs are available to the built-in and custom templates.  restockHints is replaced with the hints for the
+// call when the template is executed.
+func templateFuncs(ranking StoreRanking) template.FuncMap {
+	return template.FuncMap{
+		"topStores": func(stores []schema.StoreResult) []schema.StoreResult {
+			return ranking.Top(stores)
+		},
+		"otherStores": func(stores []schema.StoreResult) *StoreSummary {
+			return ranking.Rest(stores)
+		},
+		"restockHints": func() []string {
+			return nil
+		},
+	}
+}
@@ -0,0 +1,134 @@
+package formatter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+var rankingStores = []schema.StoreResult{
+	{StoreID: "far-plenty", Distance: 20, AvailableToPromise: 10},
+	{StoreID: "near-few", Distance: 1, AvailableToPromise: 1},
+	{StoreID: "mid-some", Distance: 5, AvailableToPromise: 6},
+	{StoreID: "mid-few", Distance: 5, AvailableToPromise: 1},
+}
+
+func TestStoreRanking_Rank(t *testing.T) {
+	cases := map[string]struct {
+		ranking  StoreRanking
+		expected []string
+	}{
+		"Distance sorts nearest first, ties by quantity": {
+			ranking:  StoreRanking{SortBy: sortByDistance},
+			expected: []string{"near-few", "mid-some", "mid-few", "far-plenty"},
+		},
+		"Quantity sorts most first, ties by distance": {
+			ranking:  StoreRanking{SortBy: sortByQuantity},
+			expected: []string{"far-plenty", "mid-some", "near-few", "mid-few"},
+		},
+		"Score balances distance and quantity": {
+			ranking:  StoreRanking{SortBy: sortByScore, DistanceWeight: 0.5},
+			expected: []string{"mid-some", "near-few", "far-plenty", "mid-few"},
+		},
+		"Score weighted to quantity only": {
+			ranking:  StoreRanking{SortBy: sortByScore, DistanceWeight: 0},
+			expected: []string{"far-plenty", "mid-some", "near-few", "mid-few"},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual := []string{}
+			for _, s := range tt.ranking.Rank(rankingStores) {
+				actual = append(actual, s.StoreID)
+			}
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("wanted %v, got %v", tt.expected, actual)
+			}
+			if rankingStores[0].StoreID != "far-plenty" {
+				t.Error("input stores were modified")
+			}
+		})
+	}
+}
+
+func TestStoreRanking_TopAndRest(t *testing.T) {
+	cases := map[string]struct {
+		ranking      StoreRanking
+		expectedTop  int
+		expectedRest *StoreSummary
+	}{
+		"Limit caps the list and summarizes the rest": {
+			ranking:      StoreRanking{SortBy: sortByDistance, Limit: 2},
+			expectedTop:  2,
+			expectedRest: &StoreSummary{Count: 2, Units: 11},
+		},
+		"Limit larger than stores lists all": {
+			ranking:     StoreRanking{SortBy: sortByDistance, Limit: 10},
+			expectedTop: 4,
+		},
+		"No limit lists all": {
+			ranking:     StoreRanking{SortBy: sortByDistance},
+			expectedTop: 4,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			if top := tt.ranking.Top(rankingStores); len(top) != tt.expectedTop {
+				t.Errorf("wanted %d stores, got %d", tt.expectedTop, len(top))
+			}
+			if rest := tt.ranking.Rest(rankingStores); !reflect.DeepEqual(rest, tt.expectedRest) {
+				t.Errorf("wanted %v, got %v", tt.expectedRest, rest)
+			}
+		})
+	}
+}
+
+func TestPickupTemplate_Ranking(t *testing.T) {
+	h := testHandler()
+	h.storeRanking = StoreRanking{SortBy: sortByDistance, Limit: 2}
+	h.prepareTemplates()
+
+	actual, err := executeTemplate(h.pickupTemplate, []schema.Product{
+		{
+			ProductQuery: schema.ProductQuery{Name: "formula", DesiredQuantity: 1},
+			Result:       schema.ProductResult{Pickup: schema.PickupResult{Stores: rankingStores, TotalStores: len(rankingStores)}},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Index(actual, "near-few") > strings.Index(actual, "mid-some") {
+		t.Errorf("expected nearest store first:\n%s", actual)
+	}
+	if strings.Contains(actual, "far-plenty") || strings.Contains(actual, "mid-few") {
+		t.Errorf("expected stores past the limit to be left out:\n%s", actual)
+	}
+	if !strings.Contains(actual, "Distance: 1.0 miles") {
+		t.Errorf("expected distance to be listed:\n%s", actual)
+	}
+	if !strings.Contains(actual, "+2 more stores, 11 units total") {
+		t.Errorf("expected summary of remaining stores:\n%s", actual)
+	}
+}
+
+func TestPickupTemplate_Escaping(t *testing.T) {
+	actual, err := executeTemplate(testHandler().pickupTemplate, []schema.Product{
+		{
+			ProductQuery: schema.ProductQuery{Name: "<b>formula</b>", DesiredQuantity: 1},
+			Result: schema.ProductResult{Pickup: schema.PickupResult{
+				Stores:      []schema.StoreResult{{LocationName: `<script>alert("hi")</script>`, StoreID: "1234"}},
+				TotalStores: 1,
+			}},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Contains(actual, "<b>") || strings.Contains(actual, "<script>") {
+		t.Errorf("expected the names from the API to be escaped:\n%s", actual)
+	}
+}
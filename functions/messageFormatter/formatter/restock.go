@@ -0,0 +1,99 @@
+package formatter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+// loadSummaryOrNil reads the summary written by the Historical Stats function on its last run.  Errors are logged.
+func (h *Handler) loadSummaryOrNil(ctx context.Context) *schema.Summary {
+	if h.statsAPI == nil || h.statsBucket == "" {
+		return nil
+	}
+	b, err := getStatsObject(ctx, h.statsAPI, h.statsBucket, schema.SummaryObjectKey)
+	if err != nil {
+		h.logger.Printf("unable to load stats summary: %s\n", err)
+		return nil
+	}
+	var summary schema.Summary
+	if err := json.Unmarshal(b, &summary); err != nil {
+		h.logger.Printf("unable to load stats summary: %s\n", err)
+		return nil
+	}
+	return &summary
+}
+
+// restockNoticeWindow is how soon a restock must start to be announced in an alert without products.  The state
+// machine runs hourly, so each restock is announced by one run rather than by every run until it starts.
+const restockNoticeWindow = time.Hour
+
+// restockHint is when an out of stock product has most often been restocked.
+type restockHint struct {
+	Name     string
+	Start    time.Time
+	Restocks int
+	Weeks    int
+}
+
+func (h restockHint) String() string {
+	return fmt.Sprintf("%s: %s UTC (restocked then %d of the last %d weeks)", h.Name, h.Start.Format("Mon 15:04"), h.Restocks, h.Weeks)
+}
+
+// restockHints describes when each product without stores has most often been restocked, so subscribers know when
+// to check again.  Products without a likely restock in the future are left out.
+func restockHints(summary *schema.Summary, products []schema.Product, now time.Time) []restockHint {
+	if summary == nil {
+		return nil
+	}
+	hints := []restockHint{}
+	for _, p := range products {
+		if p.Result.Pickup.TotalStores > 0 {
+			continue
+		}
+		for _, s := range summary.Products {
+			if !s.Matches(p.ProductQuery) {
+				continue
+			}
+			if w := s.LikelyRestock; w != nil && w.End > now.Unix() {
+				hints = append(hints, restockHint{
+					Name:     p.Name,
+					Start:    time.Unix(w.Start, 0).UTC(),
+					Restocks: int(math.Round(w.RestockProbability * float64(w.Weeks))),
+					Weeks:    w.Weeks,
+				})
+			}
+			break
+		}
+	}
+	return hints
+}
+
+// alertHints are the restock hints for an alert of the alerted products.  An alert with products has every hint, one
+// without is only for the restocks starting before the next run, so it is not sent again by every run until then.
+func alertHints(summary *schema.Summary, products, alerted []schema.Product, now time.Time) []restockHint {
+	hints := restockHints(summary, products, now)
+	if len(alerted) > 0 {
+		return hints
+	}
+	upcoming := []restockHint{}
+	for _, h := range hints {
+		if !h.Start.Before(now) && h.Start.Before(now.Add(restockNoticeWindow)) {
+			upcoming = append(upcoming, h)
+		}
+	}
+	return upcoming
+}
+
+// hintLines are the hints as the templates list them.
+func hintLines(hints []restockHint) []string {
+	lines := make([]string, 0, len(hints))
+	for _, h := range hints {
+		lines = append(lines, h.String())
+	}
+	return lines
+}
@@ -0,0 +1,170 @@
+package formatter
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+func TestRestockHints(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2022, 6, 8, 12, 0, 0, 0, time.UTC)
+	tuesday := time.Date(2022, 6, 14, 9, 0, 0, 0, time.UTC)
+	summary := &schema.Summary{Products: []schema.ProductSummary{
+		{TCIN: "123", ProductName: "formula", LikelyRestock: &schema.ForecastWindow{
+			Start: tuesday.Unix(), End: tuesday.Add(time.Hour).Unix(), RestockProbability: 0.75, Weeks: 4,
+		}},
+		{TCIN: "456", ProductName: "in stock formula", LikelyRestock: &schema.ForecastWindow{
+			Start: tuesday.Unix(), End: tuesday.Add(time.Hour).Unix(), RestockProbability: 1, Weeks: 4,
+		}},
+		{TCIN: "789", ProductName: "stale formula", LikelyRestock: &schema.ForecastWindow{
+			Start: now.Add(-2 * time.Hour).Unix(), End: now.Add(-time.Hour).Unix(), RestockProbability: 1, Weeks: 4,
+		}},
+		{TCIN: "000", ProductName: "new formula"},
+	}}
+	products := []schema.Product{
+		{ProductQuery: schema.ProductQuery{Name: "renamed formula", TCIN: "123"}},
+		{ProductQuery: schema.ProductQuery{Name: "in stock formula", TCIN: "456"}, Result: schema.ProductResult{Pickup: schema.PickupResult{TotalStores: 1}}},
+		{ProductQuery: schema.ProductQuery{Name: "stale formula", TCIN: "789"}},
+		{ProductQuery: schema.ProductQuery{Name: "new formula", TCIN: "000"}},
+		{ProductQuery: schema.ProductQuery{Name: "untracked formula", TCIN: "999"}},
+	}
+	cases := map[string]struct {
+		summary  *schema.Summary
+		expected []string
+	}{
+		"Out of stock products with a coming restock have hints": {
+			summary:  summary,
+			expected: []string{"renamed formula: Tue 09:00 UTC (restocked then 3 of the last 4 weeks)"},
+		},
+		"No summary has no hints": {
+			expected: []string{},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual := hintLines(restockHints(tt.summary, products, now))
+			if !reflect.DeepEqual(tt.expected, actual) {
+				t.Errorf("wanted %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestAlertHints(t *testing.T) {
+	now := time.Date(2022, 6, 14, 8, 30, 0, 0, time.UTC)
+	forecast := func(start time.Time) *schema.ForecastWindow {
+		return &schema.ForecastWindow{Start: start.Unix(), End: start.Add(time.Hour).Unix(), RestockProbability: 1, Weeks: 4}
+	}
+	summary := &schema.Summary{Products: []schema.ProductSummary{
+		{TCIN: "123", ProductName: "formula", LikelyRestock: forecast(now.Add(30 * time.Minute))},
+		{TCIN: "456", ProductName: "wipes", LikelyRestock: forecast(now.Add(24 * time.Hour))},
+		{TCIN: "789", ProductName: "bibs", LikelyRestock: forecast(now.Add(-30 * time.Minute))},
+	}}
+	products := []schema.Product{
+		{ProductQuery: schema.ProductQuery{Name: "formula", TCIN: "123"}},
+		{ProductQuery: schema.ProductQuery{Name: "wipes", TCIN: "456"}},
+		{ProductQuery: schema.ProductQuery{Name: "bibs", TCIN: "789"}},
+	}
+	cases := map[string]struct {
+		alerted  []schema.Product
+		expected []string
+	}{
+		"An alert with products has every hint": {
+			alerted:  []schema.Product{{ProductQuery: schema.ProductQuery{Name: "bottles", TCIN: "000"}}},
+			expected: []string{"formula", "wipes", "bibs"},
+		},
+		"An alert without products only has restocks before the next run": {
+			expected: []string{"formula"},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual := []string{}
+			for _, h := range alertHints(summary, products, tt.alerted, now) {
+				actual = append(actual, h.Name)
+			}
+			if !reflect.DeepEqual(tt.expected, actual) {
+				t.Errorf("wanted %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTemplates_RestockHints(t *testing.T) {
+	hints := []string{"formula: Tue 09:00 UTC (restocked then 3 of the last 4 weeks)"}
+	expected := "Likely restock times for products still out of stock:\nformula: Tue 09:00 UTC (restocked then 3 of the last 4 weeks)\n"
+	cases := map[string]struct {
+		name     string
+		builtin  string
+		products []schema.Product
+	}{
+		"Pickup":                  {name: pickupTemplateName, builtin: pickupEmailTpl, products: sampleProducts},
+		"Pickup without products": {name: pickupTemplateName, builtin: pickupEmailTpl, products: []schema.Product{}},
+		"Shipping":                {name: shippingTemplateName, builtin: shippingEmailTpl, products: sampleProducts},
+		"Shipping without products": {
+			name: shippingTemplateName, builtin: shippingEmailTpl, products: []schema.Product{},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			tpl := testHandler().loadTemplate(context.Background(), tt.name, tt.builtin)
+
+			actual, err := executeTemplate(tpl, tt.products, hints)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(tt.products) == 0 && actual != expected {
+				t.Errorf("expected only the hints:\n%s", actual)
+			}
+			if !strings.HasSuffix(actual, "\n\n"+expected) && len(tt.products) > 0 {
+				t.Errorf("expected the hints at the end of the message:\n%s", actual)
+			}
+			// the hints are only for the call they were passed to
+			if actual, err := executeTemplate(tpl, tt.products, nil); err != nil || strings.Contains(actual, "Likely restock") {
+				t.Errorf("expected no hints in the next message, got %v:\n%s", err, actual)
+			}
+		})
+	}
+}
+
+func TestHandler_RestockHintsWithoutProducts(t *testing.T) {
+	now := time.Now()
+	dir := t.TempDir()
+	summary := schema.Summary{Products: []schema.ProductSummary{{
+		TCIN: "123", ProductName: "formula", LikelyRestock: &schema.ForecastWindow{
+			Start: now.Add(30 * time.Minute).Unix(), End: now.Add(90 * time.Minute).Unix(), RestockProbability: 1, Weeks: 4,
+		},
+	}}}
+	b, _ := json.Marshal(summary)
+	if err := os.WriteFile(filepath.Join(dir, schema.SummaryObjectKey), b, 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	h := testHandler()
+	h.statsAPI, h.statsBucket = DirStatsObjects(dir), dir
+	input := schema.ProductsInput{Products: []schema.Product{{ProductQuery: schema.ProductQuery{Name: "formula", TCIN: "123"}}}}
+
+	actual, err := h.Handle(context.Background(), input)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for name, message := range map[string]string{
+		"pickup": actual.Pickup, "shipping": actual.Shipping, "pickup SMS": actual.PickupSMS, "shipping SMS": actual.ShippingSMS,
+	} {
+		if !strings.Contains(message, "formula: ") {
+			t.Errorf("expected a hint in the %s message, got %q", name, message)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package formatter
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+const (
+	smsMaxLengthEnv     = "SMS_MAX_LENGTH"
+	defaultSMSMaxLength = 160
+	// Messages longer than one segment are split by SNS in to 153 character parts, 320 keeps it to two segments.
+	maxSMSMaxLength = 320
+	// Ellipsis is spelled out because "…" is not in the GSM-7 alphabet and would force the whole message to UCS-2.
+	smsEllipsis = "..."
+	// Names are never truncated below this length unless there is no other way to fit the message.
+	smsMinNameLength = 12
+)
+
+// Product URLs look like https://www.target.com/p/some-long-slug/-/A-82052064, the slug is optional.
+var productIDPattern = regexp.MustCompile(`/(A-\d+)`)
+
+// loadSMSMaxLength reads the SMS length limit from the environment.
+func loadSMSMaxLength() (int, error) {
+	raw := os.Getenv(smsMaxLengthEnv)
+	if raw == "" {
+		return defaultSMSMaxLength, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, err
+	}
+	if n < defaultSMSMaxLength || n > maxSMSMaxLength {
+		return 0, fmt.Errorf("%s must be between %d and %d, got %d", smsMaxLengthEnv, defaultSMSMaxLength, maxSMSMaxLength, n)
+	}
+	return n, nil
+}
+
+// formatPickupSMS describes the first product and its nearest store.  Remaining products are summarized as "and N more".
+func formatPickupSMS(products []schema.Product, limit int) string {
+	if len(products) == 0 {
+		return ""
+	}
+	p := products[0]
+	store := schema.StoreResult{}
+	if nearest := (StoreRanking{SortBy: sortByDistance}).Top(p.Result.Pickup.Stores); len(nearest) > 0 {
+		store = nearest[0]
+	}
+	otherStores := ""
+	if p.Result.Pickup.TotalStores > 1 {
+		otherStores = fmt.Sprintf(" (+%d stores)", p.Result.Pickup.TotalStores-1)
+	}
+	return fitSMS(p.Name, store.LocationName, fmt.Sprintf(": %d at ", store.AvailableToPromise), otherStores+" "+shortProductURL(p.ProductURL)+moreSuffix(len(products)-1), limit)
+}
+
+// formatShippingSMS describes the first product available online.  Remaining products are summarized as "and N more".
+func formatShippingSMS(products []schema.Product, limit int) string {
+	if len(products) == 0 {
+		return ""
+	}
+	p := products[0]
+	return fitSMS(p.Name, "", fmt.Sprintf(": %d online", p.Result.Shipping.AvailableToPromise), " "+shortProductURL(p.ProductURL)+moreSuffix(len(products)-1), limit)
+}
+
+// formatRestockSMS describes the first restock hint, for an alert without products.  Remaining hints are summarized as
+// "and N more".
+func formatRestockSMS(hints []restockHint, limit int) string {
+	if len(hints) == 0 {
+		return ""
+	}
+	h := hints[0]
+	return fitSMS(h.Name, "", ": likely restock "+h.Start.Format("Mon 15:04")+" UTC", moreSuffix(len(hints)-1), limit)
+}
+
+// fitSMS joins `name + middle + store + tail` and truncates it to limit characters.
+// middle and tail are never truncated.  Truncation is deterministic: the product name is shortened first, down to
+// smsMinNameLength, then the store name, and finally the product name again.
+func fitSMS(name, store, middle, tail string, limit int) string {
+	budget := limit - length(middle) - length(tail)
+	if budget < 0 {
+		budget = 0
+	}
+	if length(name)+length(store) > budget {
+		nameBudget := budget - length(store)
+		if nameBudget < smsMinNameLength {
+			nameBudget = smsMinNameLength
+		}
+		name = truncate(name, nameBudget)
+	}
+	if length(name)+length(store) > budget {
+		store = truncate(store, budget-length(name))
+	}
+	if length(name)+length(store) > budget {
+		name = truncate(name, budget-length(store))
+	}
+	// If the fixed parts alone do not fit, which only happens with absurd product URLs, cut the end off
+	return truncate(name+middle+store+tail, limit)
+}
+
+// truncate shortens s to at most n characters, marking the cut with an ellipsis when there is room for one.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	if n < 0 {
+		n = 0
+	}
+	if n <= len(smsEllipsis) {
+		return string(r[:n])
+	}
+	return string(r[:n-len(smsEllipsis)]) + smsEllipsis
+}
+
+func length(s string) int {
+	return utf8.RuneCountInString(s)
+}
+
+func moreSuffix(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" and %d more", n)
+}
+
+// shortProductURL drops the scheme and descriptive slug from a Target product URL.
+func shortProductURL(productURL string) string {
+	if m := productIDPattern.FindStringSubmatch(productURL); m != nil {
+		return "target.com/p/-/" + m[1]
+	}
+	return productURL
+}
@@ -0,0 +1,155 @@
+package formatter
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+func smsProduct(name string, stores ...schema.StoreResult) schema.Product {
+	return schema.Product{
+		ProductQuery: schema.ProductQuery{
+			Name:       name,
+			ProductURL: "https://www.target.com/p/gentle-non-gmo-powder-infant-formula-up-up/-/A-82052064",
+		},
+		Result: schema.ProductResult{
+			Pickup:   schema.PickupResult{Stores: stores, TotalStores: len(stores)},
+			Shipping: schema.ShippingResult{AvailableToPromise: 5, IsAvailable: true},
+		},
+	}
+}
+
+func TestFormatPickupSMS(t *testing.T) {
+	denver := schema.StoreResult{AvailableToPromise: 3, LocationName: "Denver"}
+	aurora := schema.StoreResult{AvailableToPromise: 1, LocationName: "Aurora"}
+	longName := strings.Repeat("Up&Up Sensitive Non-GMO Powder Infant Formula ", 10)
+	longStore := strings.Repeat("Highlands Ranch Town Center ", 8)
+	cases := map[string]struct {
+		products []schema.Product
+		limit    int
+		expected string
+	}{
+		"No products returns empty": {
+			limit:    160,
+			expected: "",
+		},
+		"Single store fits": {
+			products: []schema.Product{smsProduct("formula", denver)},
+			limit:    160,
+			expected: "formula: 3 at Denver target.com/p/-/A-82052064",
+		},
+		"Other stores and products are summarized": {
+			products: []schema.Product{smsProduct("formula", denver, aurora), smsProduct("other", aurora), smsProduct("third", aurora)},
+			limit:    160,
+			expected: "formula: 3 at Denver (+1 stores) target.com/p/-/A-82052064 and 2 more",
+		},
+		"Long name is truncated first": {
+			products: []schema.Product{smsProduct(longName, denver), smsProduct("other", aurora)},
+			limit:    160,
+			expected: longName[:160-len(": 3 at Denver target.com/p/-/A-82052064 and 1 more")-3] + "...: 3 at Denver target.com/p/-/A-82052064 and 1 more",
+		},
+		"Long store is truncated after name": {
+			products: []schema.Product{smsProduct(longName, schema.StoreResult{AvailableToPromise: 2, LocationName: longStore})},
+			limit:    160,
+			expected: longName[:smsMinNameLength-3] + "...: 2 at " + longStore[:160-smsMinNameLength-len(": 2 at  target.com/p/-/A-82052064")-3] + "... target.com/p/-/A-82052064",
+		},
+		"Longer limit fits more": {
+			products: []schema.Product{smsProduct(longName, denver)},
+			limit:    320,
+			expected: longName[:320-len(": 3 at Denver target.com/p/-/A-82052064")-3] + "...: 3 at Denver target.com/p/-/A-82052064",
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual := formatPickupSMS(tt.products, tt.limit)
+			if actual != tt.expected {
+				t.Errorf("wanted:\n%q\ngot:\n%q", tt.expected, actual)
+			}
+			if n := utf8.RuneCountInString(actual); n > tt.limit {
+				t.Errorf("message is %d characters, limit is %d", n, tt.limit)
+			}
+		})
+	}
+}
+
+func TestFormatShippingSMS(t *testing.T) {
+	cases := map[string]struct {
+		products []schema.Product
+		limit    int
+		expected string
+	}{
+		"Single product fits": {
+			products: []schema.Product{smsProduct("formula")},
+			limit:    160,
+			expected: "formula: 5 online target.com/p/-/A-82052064",
+		},
+		"Other products are summarized": {
+			products: []schema.Product{smsProduct("formula"), smsProduct("other")},
+			limit:    160,
+			expected: "formula: 5 online target.com/p/-/A-82052064 and 1 more",
+		},
+		"Multibyte names are truncated by character": {
+			products: []schema.Product{smsProduct(strings.Repeat("é", 200))},
+			limit:    160,
+			expected: strings.Repeat("é", 160-len(": 5 online target.com/p/-/A-82052064")-3) + "...: 5 online target.com/p/-/A-82052064",
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual := formatShippingSMS(tt.products, tt.limit)
+			if actual != tt.expected {
+				t.Errorf("wanted:\n%q\ngot:\n%q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFormatRestockSMS(t *testing.T) {
+	tuesday := time.Date(2022, 6, 14, 9, 0, 0, 0, time.UTC)
+	cases := map[string]struct {
+		hints    []restockHint
+		expected string
+	}{
+		"No hints": {},
+		"Single hint": {
+			hints:    []restockHint{{Name: "formula", Start: tuesday}},
+			expected: "formula: likely restock Tue 09:00 UTC",
+		},
+		"Other hints are summarized": {
+			hints:    []restockHint{{Name: "formula", Start: tuesday}, {Name: "wipes", Start: tuesday}},
+			expected: "formula: likely restock Tue 09:00 UTC and 1 more",
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			if actual := formatRestockSMS(tt.hints, 160); actual != tt.expected {
+				t.Errorf("wanted:\n%q\ngot:\n%q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestShortProductURL(t *testing.T) {
+	cases := map[string]struct {
+		input    string
+		expected string
+	}{
+		"Slug is removed":          {input: "https://www.target.com/p/advantage-powder-infant-formula-up-up/-/A-82052069", expected: "target.com/p/-/A-82052069"},
+		"Unknown URL is unchanged": {input: "https://example.com/formula", expected: "https://example.com/formula"},
+		"Empty URL remains empty":  {input: "", expected: ""},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			if actual := shortProductURL(tt.input); actual != tt.expected {
+				t.Errorf("wanted %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
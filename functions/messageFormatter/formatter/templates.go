@@ -0,0 +1,119 @@
+package formatter
+
+import (
+	"context"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	templateDirEnv    = "TEMPLATE_DIR"
+	templateBucketEnv = "TEMPLATE_BUCKET_NAME"
+	templatePrefixEnv = "TEMPLATE_PREFIX"
+	templateExt       = ".tmpl"
+)
+
+// TemplateSource reads the raw text of a named template.
+type TemplateSource interface {
+	ReadTemplate(ctx context.Context, name string) (string, error)
+}
+
+type S3GetObjectAPI interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// DirTemplateSource reads templates from `<dir>/<name>.tmpl` on the local filesystem.
+type DirTemplateSource string
+
+func (d DirTemplateSource) ReadTemplate(ctx context.Context, name string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(string(d), name+templateExt))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// S3TemplateSource reads templates from `<prefix><name>.tmpl` in an S3 bucket.
+type S3TemplateSource struct {
+	API    S3GetObjectAPI
+	Bucket string
+	Prefix string
+}
+
+func (s S3TemplateSource) ReadTemplate(ctx context.Context, name string) (string, error) {
+	out, err := s.API.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.Prefix + name + templateExt),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer out.Body.Close()
+	b, err := io.ReadAll(out.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// sampleProducts is used to validate custom templates before they replace the built-in ones.
+var sampleProducts = []schema.Product{
+	{
+		ProductQuery: schema.ProductQuery{
+			Name:            "sample product",
+			DesiredQuantity: 1,
+			ProductURL:      "https://www.target.com/p/sample/-/A-00000000",
+			TCIN:            "00000000",
+		},
+		Result: schema.ProductResult{
+			Pickup: schema.PickupResult{
+				Stores: []schema.StoreResult{
+					{
+						AvailableToPromise: 2,
+						LocationName:       "Sample Store",
+						StoreID:            "0000",
+						MailingAddress: schema.StoreMailingAddress{
+							AddressLine1: "123 Main St",
+							City:         "Denver",
+							PostalCode:   "80000",
+							State:        "Colorado",
+						},
+					},
+				},
+				TotalStores: 1,
+			},
+			Shipping: schema.ShippingResult{AvailableToPromise: 2, IsAvailable: true},
+		},
+	},
+}
+
+// loadTemplate returns the template `name` from the templates of h if it parses and renders the sample products.
+// Any failure is logged and the built-in template is returned instead.
+func (h *Handler) loadTemplate(ctx context.Context, name, builtin string) *template.Template {
+	fallback := template.Must(template.New(name).Funcs(templateFuncs(h.storeRanking)).Parse(builtin))
+	if h.templates == nil {
+		return fallback
+	}
+	text, err := h.templates.ReadTemplate(ctx, name)
+	if err != nil {
+		h.logger.Printf("unable to read %s template, using built-in: %s\n", name, err)
+		return fallback
+	}
+	t, err := template.New(name).Funcs(templateFuncs(h.storeRanking)).Parse(text)
+	if err != nil {
+		h.logger.Printf("unable to parse %s template, using built-in: %s\n", name, err)
+		return fallback
+	}
+	if _, err := executeTemplate(t, sampleProducts, nil); err != nil {
+		h.logger.Printf("unable to render %s template with sample data, using built-in: %s\n", name, err)
+		return fallback
+	}
+	h.logger.Printf("using custom %s template\n", name)
+	return t
+}
@@ -0,0 +1,107 @@
+package formatter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type mockS3GetObjectAPI func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+
+func (m mockS3GetObjectAPI) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+func TestLoadTemplate(t *testing.T) {
+	builtin := "built-in {{ len . }}"
+	cases := map[string]struct {
+		src      func(t *testing.T) TemplateSource
+		expected string
+	}{
+		"No source uses built-in": {
+			src:      func(t *testing.T) TemplateSource { return nil },
+			expected: "built-in 1",
+		},
+		"Directory template is used": {
+			src: func(t *testing.T) TemplateSource {
+				dir := t.TempDir()
+				writeTemplate(t, dir, "custom {{ range . }}{{ .Name }}{{ end }}")
+				return DirTemplateSource(dir)
+			},
+			expected: "custom sample product",
+		},
+		"Missing file uses built-in": {
+			src:      func(t *testing.T) TemplateSource { return DirTemplateSource(t.TempDir()) },
+			expected: "built-in 1",
+		},
+		"Unparsable template uses built-in": {
+			src: func(t *testing.T) TemplateSource {
+				dir := t.TempDir()
+				writeTemplate(t, dir, "{{ range . }")
+				return DirTemplateSource(dir)
+			},
+			expected: "built-in 1",
+		},
+		"Template failing sample data uses built-in": {
+			src: func(t *testing.T) TemplateSource {
+				dir := t.TempDir()
+				writeTemplate(t, dir, "{{ range . }}{{ .NoSuchField }}{{ end }}")
+				return DirTemplateSource(dir)
+			},
+			expected: "built-in 1",
+		},
+		"S3 template is used": {
+			src: func(t *testing.T) TemplateSource {
+				api := mockS3GetObjectAPI(func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+					t.Helper()
+					if *params.Bucket != "templates" || *params.Key != "alerts/test_template.tmpl" {
+						t.Errorf("unexpected bucket or key: %s %s", *params.Bucket, *params.Key)
+					}
+					return &s3.GetObjectOutput{
+						Body: io.NopCloser(bytes.NewReader([]byte("from s3 {{ len . }}"))),
+					}, nil
+				})
+				return S3TemplateSource{API: api, Bucket: "templates", Prefix: "alerts/"}
+			},
+			expected: "from s3 1",
+		},
+		"S3 error uses built-in": {
+			src: func(t *testing.T) TemplateSource {
+				api := mockS3GetObjectAPI(func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+					return nil, errors.New("access denied")
+				})
+				return S3TemplateSource{API: api, Bucket: "templates"}
+			},
+			expected: "built-in 1",
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := testHandler()
+			h.templates = tt.src(t)
+			tpl := h.loadTemplate(context.Background(), "test_template", builtin)
+
+			actual, err := executeTemplate(tpl, sampleProducts, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if actual != tt.expected {
+				t.Errorf("wanted %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func writeTemplate(t *testing.T, dir, text string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "test_template"+templateExt), []byte(text), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
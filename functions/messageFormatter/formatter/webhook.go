@@ -0,0 +1,327 @@
+package formatter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+const (
+	webhookSubscriptionsEnv = "WEBHOOK_SUBSCRIPTIONS"
+	platformSlack           = "slack"
+	platformDiscord         = "discord"
+	platformTeams           = "teams"
+	alertTitle              = "Product Alert!"
+	// Discord rejects messages with more than 10 embeds or 25 fields in an embed.
+	discordMaxEmbeds = 10
+	discordMaxFields = 25
+	notifyTimeoutEnv = "NOTIFY_TIMEOUT"
+	// Lambda waits for the slowest subscriber, so one that hangs must not use up the whole invocation.
+	defaultNotifyTimeout = 5 * time.Second
+)
+
+// WebhookSubscription is a chat incoming webhook that should receive alerts.
+type WebhookSubscription struct {
+	Platform string `json:"platform"`
+	URL      string `json:"url"`
+	Pickup   bool   `json:"pickup"`
+	Shipping bool   `json:"shipping"`
+}
+
+// loadWebhookSubscriptions reads the JSON list of subscriptions from the environment.
+func loadWebhookSubscriptions() ([]WebhookSubscription, error) {
+	raw := os.Getenv(webhookSubscriptionsEnv)
+	if raw == "" {
+		return nil, nil
+	}
+	var subs []WebhookSubscription
+	if err := json.Unmarshal([]byte(raw), &subs); err != nil {
+		return nil, err
+	}
+	for _, s := range subs {
+		switch s.Platform {
+		case platformSlack, platformDiscord, platformTeams:
+		default:
+			return nil, fmt.Errorf("unknown webhook platform: %q", s.Platform)
+		}
+	}
+	return subs, nil
+}
+
+// loadNotifyTimeout reads how long each webhook or push request may take from the environment.
+func loadNotifyTimeout() (time.Duration, error) {
+	raw := os.Getenv(notifyTimeoutEnv)
+	if raw == "" {
+		return defaultNotifyTimeout, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s must be positive, got %s", notifyTimeoutEnv, d)
+	}
+	return d, nil
+}
+
+// notifyWebhooks posts the available products to every webhook subscription that wants them.
+// Failures are logged rather than returned so one broken webhook does not block the other alerts.
+func (h *Handler) notifyWebhooks(ctx context.Context, pickup, shipping []schema.Product) {
+	for _, s := range h.subscriptions {
+		if s.Pickup && len(pickup) > 0 {
+			if err := h.postWebhook(ctx, s, webhookPayload(s.Platform, pickupAlert(pickup, h.storeRanking))); err != nil {
+				h.logger.Printf("unable to send pickup alert to %s webhook: %s\n", s.Platform, err)
+			}
+		}
+		if s.Shipping && len(shipping) > 0 {
+			if err := h.postWebhook(ctx, s, webhookPayload(s.Platform, shippingAlert(shipping))); err != nil {
+				h.logger.Printf("unable to send shipping alert to %s webhook: %s\n", s.Platform, err)
+			}
+		}
+	}
+}
+
+func (h *Handler) postWebhook(ctx context.Context, s WebhookSubscription, payload any) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return h.doRequest(req)
+}
+
+// doRequest sends req and returns an error including the start of the response body for any non 2xx status.  The
+// request is given up after notifyTimeout.
+func (h *Handler) doRequest(req *http.Request) error {
+	ctx, cancel := context.WithTimeout(req.Context(), h.notifyTimeout)
+	defer cancel()
+	resp, err := h.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, body)
+	}
+	return nil
+}
+
+// alert is a platform neutral description of a message.  Each product becomes an item with its own link.
+type alert struct {
+	Summary string
+	Items   []alertItem
+}
+
+type alertItem struct {
+	Title  string
+	URL    string
+	Text   string
+	Fields []alertField
+}
+
+type alertField struct {
+	Name  string
+	Value string
+}
+
+func pickupAlert(products []schema.Product, ranking StoreRanking) alert {
+	a := alert{Summary: fmt.Sprintf("%d product(s) available for in-store pickup", len(products))}
+	for _, p := range products {
+		item := alertItem{
+			Title: p.Name,
+			URL:   p.ProductURL,
+			Text:  fmt.Sprintf("%d stores claim to have at least (%d) available", p.Result.Pickup.TotalStores, p.DesiredQuantity),
+		}
+		for _, s := range ranking.Top(p.Result.Pickup.Stores) {
+			item.Fields = append(item.Fields, alertField{
+				Name:  s.LocationName,
+				Value: fmt.Sprintf("Available: %d\n%s, %s", s.AvailableToPromise, s.MailingAddress.AddressLine1, s.MailingAddress.City),
+			})
+		}
+		if rest := ranking.Rest(p.Result.Pickup.Stores); rest != nil {
+			item.Text += "\n" + rest.String()
+		}
+		a.Items = append(a.Items, item)
+	}
+	return a
+}
+
+func shippingAlert(products []schema.Product) alert {
+	a := alert{Summary: fmt.Sprintf("%d product(s) available for online order", len(products))}
+	for _, p := range products {
+		a.Items = append(a.Items, alertItem{
+			Title: p.Name,
+			URL:   p.ProductURL,
+			Text:  fmt.Sprintf("Available for online order.  %d available", p.Result.Shipping.AvailableToPromise),
+		})
+	}
+	return a
+}
+
+func webhookPayload(platform string, a alert) any {
+	switch platform {
+	case platformDiscord:
+		return discordPayload(a)
+	case platformTeams:
+		return teamsPayload(a)
+	default:
+		return slackPayload(a)
+	}
+}
+
+// SlackMessage is a Slack incoming webhook message using Block Kit.
+type SlackMessage struct {
+	Text   string       `json:"text"`
+	Blocks []SlackBlock `json:"blocks"`
+}
+
+type SlackBlock struct {
+	Type      string        `json:"type"`
+	Text      *SlackText    `json:"text,omitempty"`
+	Fields    []SlackText   `json:"fields,omitempty"`
+	Accessory *SlackElement `json:"accessory,omitempty"`
+}
+
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type SlackElement struct {
+	Type string     `json:"type"`
+	Text *SlackText `json:"text,omitempty"`
+	URL  string     `json:"url,omitempty"`
+}
+
+func slackPayload(a alert) SlackMessage {
+	m := SlackMessage{
+		Text:   fmt.Sprintf("%s %s", alertTitle, a.Summary),
+		Blocks: []SlackBlock{{Type: "header", Text: &SlackText{Type: "plain_text", Text: alertTitle}}},
+	}
+	for _, item := range a.Items {
+		section := SlackBlock{
+			Type: "section",
+			Text: &SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*%s*\n%s", item.Title, item.Text)},
+			Accessory: &SlackElement{
+				Type: "button",
+				Text: &SlackText{Type: "plain_text", Text: "View Product"},
+				URL:  item.URL,
+			},
+		}
+		m.Blocks = append(m.Blocks, section)
+		// Slack allows at most 10 fields in a section
+		for i := 0; i < len(item.Fields); i += 10 {
+			fields := SlackBlock{Type: "section"}
+			for _, f := range item.Fields[i:min(i+10, len(item.Fields))] {
+				fields.Fields = append(fields.Fields, SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*%s*\n%s", f.Name, f.Value)})
+			}
+			m.Blocks = append(m.Blocks, fields)
+		}
+		m.Blocks = append(m.Blocks, SlackBlock{Type: "divider"})
+	}
+	return m
+}
+
+// DiscordMessage is a Discord webhook message using embeds.  The embed title links to the product.
+type DiscordMessage struct {
+	Content string         `json:"content"`
+	Embeds  []DiscordEmbed `json:"embeds"`
+}
+
+type DiscordEmbed struct {
+	Title       string         `json:"title"`
+	URL         string         `json:"url"`
+	Description string         `json:"description"`
+	Fields      []DiscordField `json:"fields,omitempty"`
+}
+
+type DiscordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+func discordPayload(a alert) DiscordMessage {
+	m := DiscordMessage{Content: fmt.Sprintf("**%s** %s", alertTitle, a.Summary)}
+	for _, item := range a.Items[:min(len(a.Items), discordMaxEmbeds)] {
+		embed := DiscordEmbed{Title: item.Title, URL: item.URL, Description: item.Text}
+		for _, f := range item.Fields[:min(len(item.Fields), discordMaxFields)] {
+			embed.Fields = append(embed.Fields, DiscordField{Name: f.Name, Value: f.Value, Inline: true})
+		}
+		m.Embeds = append(m.Embeds, embed)
+	}
+	return m
+}
+
+// TeamsMessage is a Microsoft Teams incoming webhook message using the connector card format.
+type TeamsMessage struct {
+	Type            string         `json:"@type"`
+	Context         string         `json:"@context"`
+	Summary         string         `json:"summary"`
+	Title           string         `json:"title"`
+	Sections        []TeamsSection `json:"sections"`
+	PotentialAction []TeamsAction  `json:"potentialAction"`
+}
+
+type TeamsSection struct {
+	ActivityTitle string      `json:"activityTitle"`
+	Text          string      `json:"text"`
+	Facts         []TeamsFact `json:"facts,omitempty"`
+}
+
+type TeamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type TeamsAction struct {
+	Type    string        `json:"@type"`
+	Name    string        `json:"name"`
+	Targets []TeamsTarget `json:"targets"`
+}
+
+type TeamsTarget struct {
+	OS  string `json:"os"`
+	URI string `json:"uri"`
+}
+
+func teamsPayload(a alert) TeamsMessage {
+	m := TeamsMessage{
+		Type:    "MessageCard",
+		Context: "https://schema.org/extensions",
+		Summary: a.Summary,
+		Title:   alertTitle,
+	}
+	for _, item := range a.Items {
+		section := TeamsSection{ActivityTitle: item.Title, Text: item.Text}
+		for _, f := range item.Fields {
+			section.Facts = append(section.Facts, TeamsFact{Name: f.Name, Value: f.Value})
+		}
+		m.Sections = append(m.Sections, section)
+		m.PotentialAction = append(m.PotentialAction, TeamsAction{
+			Type:    "OpenUri",
+			Name:    fmt.Sprintf("View %s", item.Title),
+			Targets: []TeamsTarget{{OS: "default", URI: item.URL}},
+		})
+	}
+	return m
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,246 @@
+package formatter
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+var webhookProducts = []schema.Product{
+	{
+		ProductQuery: schema.ProductQuery{
+			Name:            "special formula",
+			DesiredQuantity: 1,
+			ProductURL:      "https://www.target.com/p/special/-/A-1234",
+		},
+		Result: schema.ProductResult{
+			Pickup: schema.PickupResult{
+				Stores: []schema.StoreResult{
+					{AvailableToPromise: 3, LocationName: "Denver", StoreID: "1234"},
+					{AvailableToPromise: 1, LocationName: "Aurora", StoreID: "5678"},
+				},
+				TotalStores: 2,
+			},
+			Shipping: schema.ShippingResult{AvailableToPromise: 4, IsAvailable: true},
+		},
+	},
+}
+
+func TestNotifyWebhooks(t *testing.T) {
+	cases := map[string]struct {
+		sub      WebhookSubscription
+		pickup   []schema.Product
+		shipping []schema.Product
+		// validate is called with each request body received by the webhook
+		validate      func(t *testing.T, body []byte)
+		expectedPosts int
+	}{
+		"Slack pickup alert has blocks and a button": {
+			sub:    WebhookSubscription{Platform: platformSlack, Pickup: true},
+			pickup: webhookProducts,
+			validate: func(t *testing.T, body []byte) {
+				var m SlackMessage
+				decodeBody(t, body, &m)
+				if m.Blocks[0].Type != "header" {
+					t.Errorf("expected header block first, got %s", m.Blocks[0].Type)
+				}
+				if m.Blocks[1].Accessory == nil || m.Blocks[1].Accessory.URL != "https://www.target.com/p/special/-/A-1234" {
+					t.Errorf("expected button to product url, got %+v", m.Blocks[1].Accessory)
+				}
+				if len(m.Blocks[2].Fields) != 2 {
+					t.Errorf("expected a field per store, got %d", len(m.Blocks[2].Fields))
+				}
+			},
+			expectedPosts: 1,
+		},
+		"Discord pickup alert has embeds": {
+			sub:    WebhookSubscription{Platform: platformDiscord, Pickup: true},
+			pickup: webhookProducts,
+			validate: func(t *testing.T, body []byte) {
+				var m DiscordMessage
+				decodeBody(t, body, &m)
+				if len(m.Embeds) != 1 {
+					t.Fatalf("expected 1 embed, got %d", len(m.Embeds))
+				}
+				if m.Embeds[0].URL != "https://www.target.com/p/special/-/A-1234" || len(m.Embeds[0].Fields) != 2 {
+					t.Errorf("unexpected embed: %+v", m.Embeds[0])
+				}
+			},
+			expectedPosts: 1,
+		},
+		"Teams shipping alert has an open action": {
+			sub:      WebhookSubscription{Platform: platformTeams, Shipping: true},
+			shipping: webhookProducts,
+			validate: func(t *testing.T, body []byte) {
+				var m TeamsMessage
+				decodeBody(t, body, &m)
+				if m.Type != "MessageCard" || len(m.Sections) != 1 {
+					t.Errorf("unexpected card: %+v", m)
+				}
+				if len(m.PotentialAction) != 1 || m.PotentialAction[0].Targets[0].URI != "https://www.target.com/p/special/-/A-1234" {
+					t.Errorf("expected action to product url, got %+v", m.PotentialAction)
+				}
+				if !strings.Contains(m.Sections[0].Text, "4 available") {
+					t.Errorf("expected shipping quantity in text, got %s", m.Sections[0].Text)
+				}
+			},
+			expectedPosts: 1,
+		},
+		"Subscription only receives the alerts it wants": {
+			sub:           WebhookSubscription{Platform: platformSlack, Shipping: true},
+			pickup:        webhookProducts,
+			validate:      func(t *testing.T, body []byte) {},
+			expectedPosts: 0,
+		},
+		"Both alerts are sent": {
+			sub:           WebhookSubscription{Platform: platformSlack, Pickup: true, Shipping: true},
+			pickup:        webhookProducts,
+			shipping:      webhookProducts,
+			validate:      func(t *testing.T, body []byte) {},
+			expectedPosts: 2,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			posts := 0
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				posts++
+				if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("unexpected request: %s %s", r.Method, r.Header.Get("Content-Type"))
+				}
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				tt.validate(t, b)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer mockServer.Close()
+
+			tt.sub.URL = mockServer.URL
+			h := testHandler()
+			h.subscriptions = []WebhookSubscription{tt.sub}
+			h.notifyWebhooks(context.Background(), tt.pickup, tt.shipping)
+
+			if posts != tt.expectedPosts {
+				t.Errorf("expected %d posts, got %d", tt.expectedPosts, posts)
+			}
+		})
+	}
+}
+
+func TestPostWebhook_Error(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid_blocks"))
+	}))
+	defer mockServer.Close()
+
+	err := testHandler().postWebhook(context.Background(), WebhookSubscription{Platform: platformSlack, URL: mockServer.URL}, SlackMessage{})
+	if err == nil || !strings.Contains(err.Error(), "invalid_blocks") {
+		t.Errorf("expected error with response body, got %v", err)
+	}
+}
+
+func TestPostWebhook_Timeout(t *testing.T) {
+	done := make(chan struct{})
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer mockServer.Close()
+	defer close(done)
+	h := testHandler()
+	h.notifyTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	err := h.postWebhook(context.Background(), WebhookSubscription{Platform: platformSlack, URL: mockServer.URL}, SlackMessage{})
+	if err == nil {
+		t.Fatal("expected the request to time out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the request to be given up after %s, took %s", h.notifyTimeout, elapsed)
+	}
+}
+
+func TestLoadNotifyTimeout(t *testing.T) {
+	cases := map[string]struct {
+		env         string
+		expected    time.Duration
+		expectedErr bool
+	}{
+		"Empty returns the default": {env: "", expected: defaultNotifyTimeout},
+		"Valid duration":            {env: "2s", expected: 2 * time.Second},
+		"Zero errors":               {env: "0s", expectedErr: true},
+		"Invalid duration errors":   {env: "2", expectedErr: true},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(notifyTimeoutEnv, tt.env)
+
+			actual, err := loadNotifyTimeout()
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual != tt.expected {
+				t.Errorf("wanted %s, got %s", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestLoadWebhookSubscriptions(t *testing.T) {
+	defaultEnv := os.Environ()
+	cases := map[string]struct {
+		env         string
+		expected    int
+		expectedErr bool
+	}{
+		"Empty returns none":          {env: "", expected: 0},
+		"Valid returns subscriptions": {env: `[{"platform":"slack","url":"u","pickup":true},{"platform":"teams","url":"u"}]`, expected: 2},
+		"Unknown platform errors":     {env: `[{"platform":"irc","url":"u"}]`, expectedErr: true},
+		"Invalid JSON errors":         {env: `{`, expectedErr: true},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			defer resetEnv(defaultEnv)
+			os.Setenv(webhookSubscriptionsEnv, tt.env)
+
+			actual, err := loadWebhookSubscriptions()
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(actual) != tt.expected {
+				t.Errorf("expected %d subscriptions, got %d", tt.expected, len(actual))
+			}
+		})
+	}
+}
+
+func decodeBody(t *testing.T, body []byte, v any) {
+	t.Helper()
+	if err := json.Unmarshal(body, v); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func resetEnv(environ []string) {
+	os.Clearenv()
+	for _, env := range environ {
+		s := strings.SplitN(env, "=", 2)
+		os.Setenv(s[0], s[1])
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package checker
 
 import (
 	"github.com/akijowski/target-tracker/internal/schema"
@@ -19,6 +19,7 @@ type APIFulfillmentFiats struct {
 type APILocation struct {
 	LocationID                         string   `json:"location_id"`
 	LocationAvailableToPromiseQuantity float64  `json:"location_available_to_promise_quantity"`
+	Distance                           float64  `json:"distance"`
 	Store                              APIStore `json:"store"`
 }
 
@@ -32,6 +33,13 @@ type APIStore struct {
 type APIProduct struct {
 	TCIN        string                `json:"tcin"`
 	Fulfillment APIProductFulfillment `json:"fulfillment"`
+	Price       APIProductPrice       `json:"price"`
+}
+
+// APIProductPrice is the price of the product at the store it was requested for.
+type APIProductPrice struct {
+	CurrentRetail         float64 `json:"current_retail"`
+	FormattedCurrentPrice string  `json:"formatted_current_price"`
 }
 
 // APIProductFulfillment represents shipping and store delivery results.
@@ -0,0 +1,226 @@
+package checker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/audit"
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/aws/aws-xray-sdk-go/xray"
+)
+
+const (
+	URIEnvKey             string = "API_URI"
+	fiatBasePath          string = "/redsky_aggregations/v1/web_platform/fiats_v1"
+	fulfillmentV1BasePath string = "/redsky_aggregations/v1/web_platform/product_fulfillment_v1"
+	pdpBasePath           string = "/redsky_aggregations/v1/web_platform/pdp_client_v1"
+	URLKey                string = "9f36aeafbe60771e321a7cc95a78140772ab3e96"
+	ShippingInStock       string = "IN_STOCK"
+)
+
+// Handler checks products with the Target API, near its location.  Create it with New.
+type Handler struct {
+	logger *log.Logger
+	client *http.Client
+	// api is the URI of the Target API.
+	api      string
+	location Location
+	// results is where each check is recorded.  It is nil when no table is configured.
+	results ResultStore
+}
+
+// New sets up a Handler with cfg, which logs to l.
+func New(ctx context.Context, l *log.Logger, cfg Config) (*Handler, error) {
+	results, err := configureResultStore(ctx, l, cfg.ResultsTable, cfg.Retention)
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{logger: l, client: http.DefaultClient, api: cfg.API, location: cfg.Location, results: results}, nil
+}
+
+// Trace records the calls to the Target API with X-Ray.
+func (h *Handler) Trace() {
+	h.client = xray.Client(h.client)
+}
+
+// Handle checks the availability of the product for pickup near the location, and for shipping to it.
+func (h *Handler) Handle(ctx context.Context, productQuery schema.ProductQuery) (schema.ProductResult, error) {
+	h.logger.Printf("product query: %+v\n", productQuery)
+	if productQuery.DesiredQuantity == 0 {
+		productQuery.DesiredQuantity = 1
+	}
+	availableStores, err := h.findStoresForProduct(ctx, productQuery)
+	if err != nil {
+		return schema.ProductResult{}, err
+	}
+	h.logger.Printf("(%d) stores with product\n", len(availableStores))
+	shippingResult, err := h.findShipping(ctx, productQuery)
+	h.logger.Printf("Available for shipping: %v\n", shippingResult.IsAvailable)
+	if err != nil {
+		return schema.ProductResult{}, err
+	}
+	result := schema.ProductResult{
+		Pickup:   schema.PickupResult{Stores: availableStores, TotalStores: len(availableStores)},
+		Shipping: shippingResult,
+	}
+	if h.results != nil {
+		// the record is for auditing only, so failing to price or save it does not fail the check
+		record := audit.NewResult(productQuery, result, time.Now())
+		if record.Price, err = h.findPrice(ctx, productQuery); err != nil {
+			h.logger.Printf("unable to find price: %s\n", err)
+		}
+		if err := h.results.SaveResult(ctx, productQuery, record); err != nil {
+			h.logger.Printf("unable to save result: %s\n", err)
+		}
+	}
+	return result, nil
+}
+
+// Config is the configuration of the checker.
+type Config struct {
+	// API is the URI of the Target API.
+	API      string
+	Location Location
+	// ResultsTable is the DynamoDB table each result is saved to, or empty to save none.
+	ResultsTable string
+	// Retention is how long saved results are kept.
+	Retention audit.RetentionPolicy
+}
+
+// LoadConfig reads the configuration of the checker from the environment.
+func LoadConfig() (Config, error) {
+	cfg := Config{API: os.Getenv(URIEnvKey), ResultsTable: os.Getenv(resultsTableEnv)}
+	loc, err := configureLocation()
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Location = loc
+	if cfg.ResultsTable != "" {
+		if cfg.Retention, err = configureRetention(); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, nil
+}
+
+func (h *Handler) marshalInStoreURL(pq schema.ProductQuery) string {
+	q := url.Values{}
+	q.Set("key", URLKey)
+	q.Set("nearby", h.location.Zip)
+	q.Set("radius", strconv.Itoa(h.location.Radius))
+	q.Set("limit", "20")
+	q.Set("include_only_available_stores", "false")
+	q.Set("tcin", pq.TCIN)
+	q.Set("requested_quantity", strconv.Itoa(int(pq.DesiredQuantity)))
+
+	return fmt.Sprintf("%s%s?%s", h.api, fiatBasePath, q.Encode())
+}
+
+func (h *Handler) marshalShippingURL(pq schema.ProductQuery) string {
+	q := url.Values{}
+	q.Set("key", URLKey)
+	q.Set("is_bot", "false")
+	q.Set("tcin", pq.TCIN)
+	q.Set("store_id", h.location.StoreID)
+	q.Set("zip", h.location.ShippingZip)
+	q.Set("state", h.location.State)
+	q.Set("scheduled_delivery_store_id", h.location.StoreID)
+	q.Set("required_store_id", h.location.StoreID)
+	q.Set("has_required_store_id", "true")
+	q.Set("channel", "WEB")
+
+	return fmt.Sprintf("%s%s?%s", h.api, fulfillmentV1BasePath, q.Encode())
+}
+
+func (h *Handler) marshalPriceURL(pq schema.ProductQuery) string {
+	q := url.Values{}
+	q.Set("key", URLKey)
+	q.Set("tcin", pq.TCIN)
+	q.Set("store_id", h.location.StoreID)
+	q.Set("pricing_store_id", h.location.StoreID)
+
+	return fmt.Sprintf("%s%s?%s", h.api, pdpBasePath, q.Encode())
+}
+
+func storeResultsFromLocations(locs []APILocation) []schema.StoreResult {
+	r := []schema.StoreResult{}
+	for _, l := range locs {
+		r = append(r, schema.StoreResult{
+			AvailableToPromise: int(l.LocationAvailableToPromiseQuantity),
+			Distance:           l.Distance,
+			LocationName:       l.Store.LocationName,
+			MailingAddress:     l.Store.MailingAddress,
+			StoreID:            l.LocationID,
+		})
+	}
+	return r
+}
+
+func (h *Handler) findStoresForProduct(ctx context.Context, productQuery schema.ProductQuery) ([]schema.StoreResult, error) {
+	url := h.marshalInStoreURL(productQuery)
+	resp, err := h.doAPIRequest(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	allStores := storeResultsFromLocations(resp.Data.FulfillmentFiats.Locations)
+	h.logger.Printf("API returned results from (%d) stores\n", len(allStores))
+	filtered := []schema.StoreResult{}
+	for _, s := range allStores {
+		if s.AvailableToPromise > 0 {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered, nil
+}
+
+func (h *Handler) findShipping(ctx context.Context, productQuery schema.ProductQuery) (schema.ShippingResult, error) {
+	url := h.marshalShippingURL(productQuery)
+	result := schema.ShippingResult{}
+	resp, err := h.doAPIRequest(ctx, url)
+	if err != nil {
+		return result, err
+	}
+	result.AvailableToPromise = int(resp.Data.Product.Fulfillment.ShippingOptions.AvailableToPromiseQuantity)
+	result.IsAvailable = resp.Data.Product.Fulfillment.ShippingOptions.AvailabilityStatus == ShippingInStock
+	return result, nil
+}
+
+// findPrice is the current retail price of the product at the configured store, which is only read for the audit
+// record.
+func (h *Handler) findPrice(ctx context.Context, productQuery schema.ProductQuery) (float64, error) {
+	resp, err := h.doAPIRequest(ctx, h.marshalPriceURL(productQuery))
+	if err != nil {
+		return 0, err
+	}
+	return resp.Data.Product.Price.CurrentRetail, nil
+}
+
+func (h *Handler) doAPIRequest(ctx context.Context, url string) (result TargetAPIResult, err error) {
+	// logger.Printf("url: %s\n", url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(b, &result)
+	return
+}
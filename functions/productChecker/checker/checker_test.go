@@ -1,4 +1,4 @@
-package main
+package checker
 
 import (
 	"context"
@@ -6,17 +6,26 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
-	"os"
-	"strings"
 	"testing"
 	"time"
 
+	"github.com/akijowski/target-tracker/internal/audit"
 	"github.com/akijowski/target-tracker/internal/schema"
 )
 
-func TestHandler(t *testing.T) {
-	defaultEnv := os.Environ()
+// testHandler checks products with the API at uri, around the default location, and saves no results.
+func testHandler(uri string) *Handler {
+	return &Handler{
+		logger: log.Default(),
+		client: http.DefaultClient,
+		api:    uri,
+		location: Location{
+			Zip: defaultPickupZip, Radius: defaultRadius, StoreID: defaultStoreID, ShippingZip: defaultShippingZip, State: defaultState,
+		},
+	}
+}
 
+func TestHandler(t *testing.T) {
 	cases := map[string]struct {
 		input       schema.ProductQuery
 		expected    schema.ProductResult
@@ -67,6 +76,7 @@ func TestHandler(t *testing.T) {
 					Stores: []schema.StoreResult{
 						{
 							AvailableToPromise: 10,
+							Distance:           5.38,
 							LocationName:       "MockStore",
 							MailingAddress:     schema.StoreMailingAddress{},
 							StoreID:            "9999",
@@ -86,6 +96,7 @@ func TestHandler(t *testing.T) {
 							{
 								LocationID:                         "9999",
 								LocationAvailableToPromiseQuantity: 10,
+								Distance:                           5.38,
 								Store: APIStore{
 									StoreID:        "9999",
 									LocationName:   "MockStore",
@@ -174,7 +185,6 @@ func TestHandler(t *testing.T) {
 
 	for name, tt := range cases {
 		t.Run(name, func(t *testing.T) {
-			logger = log.Default()
 			ctx := context.Background()
 			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				t.Helper()
@@ -189,28 +199,23 @@ func TestHandler(t *testing.T) {
 					t.Fatalf("unexpected error: %s", err)
 				}
 			}))
-			defer func() {
-				mockServer.Close()
-				resetEnv(defaultEnv)
-			}()
+			defer mockServer.Close()
 
-			if err := os.Setenv(URIEnvKey, mockServer.URL); err != nil {
-				t.Fatalf("unexpected error: %s", err)
-			}
-
-			actual, err := handler(ctx, tt.input)
+			actual, err := testHandler(mockServer.URL).Handle(ctx, tt.input)
 			if err != nil {
 				t.Fatalf("unexpected error: %s", err)
 			}
-			approxTTL := time.Now().Unix() - 1
-			if actual.DBTTL < approxTTL {
-				t.Errorf("DBTTL is not correct: %d, should be greater than %d", actual.DBTTL, approxTTL)
-			}
 			if actual.Pickup.TotalStores != tt.expected.Pickup.TotalStores {
 				t.Errorf("expected %d total stores, got: %d", tt.expected.Pickup.TotalStores, actual.Pickup.TotalStores)
 			}
 			if len(actual.Pickup.Stores) != len(tt.expected.Pickup.Stores) {
 				t.Errorf("expected %d stores, got: %d", len(tt.expected.Pickup.Stores), len(actual.Pickup.Stores))
+			} else {
+				for i, s := range actual.Pickup.Stores {
+					if s.Distance != tt.expected.Pickup.Stores[i].Distance {
+						t.Errorf("expected distance %v, got: %v", tt.expected.Pickup.Stores[i].Distance, s.Distance)
+					}
+				}
 			}
 			if actual.Shipping.AvailableToPromise != tt.expected.Shipping.AvailableToPromise {
 				t.Errorf("expected %d available to promise, got: %d", tt.expected.Shipping.AvailableToPromise, actual.Shipping.AvailableToPromise)
@@ -222,9 +227,48 @@ func TestHandler(t *testing.T) {
 	}
 }
 
-func resetEnv(environ []string) {
-	for _, env := range environ {
-		s := strings.Split(env, "=")
-		os.Setenv(s[0], s[1])
+func TestLoadConfig(t *testing.T) {
+	cases := map[string]struct {
+		env         map[string]string
+		expected    Config
+		expectedErr bool
+	}{
+		"Results are not saved without a table": {
+			env: map[string]string{URIEnvKey: "https://redsky.target.com", inStockRetentionEnv: "3 days"},
+			expected: Config{
+				API:      "https://redsky.target.com",
+				Location: Location{Zip: "80134", Radius: 50, StoreID: "1976", ShippingZip: "80016", State: "CO"},
+			},
+		},
+		"Results are kept for the retention": {
+			env: map[string]string{resultsTableEnv: "results", inStockRetentionEnv: "72h"},
+			expected: Config{
+				Location:     Location{Zip: "80134", Radius: 50, StoreID: "1976", ShippingZip: "80016", State: "CO"},
+				ResultsTable: "results",
+				Retention:    audit.RetentionPolicy{InStock: 3 * 24 * time.Hour, OutOfStock: defaultRetention},
+			},
+		},
+		"Invalid location is an error": {
+			env:         map[string]string{pickupRadiusEnv: "far"},
+			expectedErr: true,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			for _, env := range []string{URIEnvKey, resultsTableEnv, inStockRetentionEnv, outOfStockRetentionEnv, pickupZipEnv, pickupRadiusEnv, shippingStoreEnv, shippingZipEnv, shippingStateEnv} {
+				t.Setenv(env, "")
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			actual, err := LoadConfig()
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("wanted error %t, got %v", tt.expectedErr, err)
+			}
+			if !tt.expectedErr && actual != tt.expected {
+				t.Errorf("wanted %+v, got %+v", tt.expected, actual)
+			}
+		})
 	}
 }
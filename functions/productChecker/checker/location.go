@@ -0,0 +1,56 @@
+package checker
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const (
+	pickupZipEnv       = "PICKUP_ZIP"
+	pickupRadiusEnv    = "PICKUP_RADIUS"
+	shippingStoreEnv   = "SHIPPING_STORE_ID"
+	shippingZipEnv     = "SHIPPING_ZIP"
+	shippingStateEnv   = "SHIPPING_STATE"
+	defaultPickupZip   = "80134"
+	defaultRadius      = 50
+	defaultStoreID     = "1976"
+	defaultShippingZip = "80016"
+	defaultState       = "CO"
+)
+
+// Location is where products are checked: stores within Radius miles of Zip for pickup, and shipping to ShippingZip
+// in State, from the store StoreID.
+type Location struct {
+	Zip         string
+	Radius      int
+	StoreID     string
+	ShippingZip string
+	State       string
+}
+
+// configureLocation reads the location from the environment.  Anything not set is the default, around Denver.
+func configureLocation() (Location, error) {
+	loc := Location{
+		Zip:         envOrDefault(pickupZipEnv, defaultPickupZip),
+		Radius:      defaultRadius,
+		StoreID:     envOrDefault(shippingStoreEnv, defaultStoreID),
+		ShippingZip: envOrDefault(shippingZipEnv, defaultShippingZip),
+		State:       envOrDefault(shippingStateEnv, defaultState),
+	}
+	if raw := os.Getenv(pickupRadiusEnv); raw != "" {
+		r, err := strconv.Atoi(raw)
+		if err != nil || r <= 0 {
+			return loc, fmt.Errorf("%s must be a positive number of miles, got %q", pickupRadiusEnv, raw)
+		}
+		loc.Radius = r
+	}
+	return loc, nil
+}
+
+func envOrDefault(env, def string) string {
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	return def
+}
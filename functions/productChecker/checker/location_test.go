@@ -0,0 +1,78 @@
+package checker
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/akijowski/target-tracker/internal/schema"
+)
+
+func TestConfigureLocation(t *testing.T) {
+	cases := map[string]struct {
+		env         map[string]string
+		expected    Location
+		expectedErr bool
+	}{
+		"Defaults to Denver": {
+			expected: Location{Zip: "80134", Radius: 50, StoreID: "1976", ShippingZip: "80016", State: "CO"},
+		},
+		"Location from the environment": {
+			env: map[string]string{
+				pickupZipEnv: "55401", pickupRadiusEnv: "20", shippingStoreEnv: "1375", shippingZipEnv: "55403", shippingStateEnv: "MN",
+			},
+			expected: Location{Zip: "55401", Radius: 20, StoreID: "1375", ShippingZip: "55403", State: "MN"},
+		},
+		"Radius must be a number": {
+			env:         map[string]string{pickupRadiusEnv: "far"},
+			expectedErr: true,
+		},
+		"Radius must be positive": {
+			env:         map[string]string{pickupRadiusEnv: "0"},
+			expectedErr: true,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			for _, env := range []string{pickupZipEnv, pickupRadiusEnv, shippingStoreEnv, shippingZipEnv, shippingStateEnv} {
+				t.Setenv(env, "")
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			actual, err := configureLocation()
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("wanted error %t, got %v", tt.expectedErr, err)
+			}
+			if !tt.expectedErr && actual != tt.expected {
+				t.Errorf("wanted %+v, got %+v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestLocationURLs(t *testing.T) {
+	h := &Handler{location: Location{Zip: "55401", Radius: 20, StoreID: "1375", ShippingZip: "55403", State: "MN"}}
+	pq := schema.ProductQuery{TCIN: "123", DesiredQuantity: 1}
+
+	pickup, err := url.Parse(h.marshalInStoreURL(pq))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if q := pickup.Query(); q.Get("nearby") != "55401" || q.Get("radius") != "20" {
+		t.Errorf("unexpected pickup query %s", pickup.RawQuery)
+	}
+	shipping, err := url.Parse(h.marshalShippingURL(pq))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	q := shipping.Query()
+	if q.Get("zip") != "55403" || q.Get("state") != "MN" {
+		t.Errorf("unexpected shipping query %s", shipping.RawQuery)
+	}
+	for _, key := range []string{"store_id", "scheduled_delivery_store_id", "required_store_id"} {
+		if q.Get(key) != "1375" {
+			t.Errorf("wanted %s 1375, got %q", key, q.Get(key))
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/audit"
+	"github.com/akijowski/target-tracker/internal/awsclient"
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	resultsTableEnv        = "RESULTS_TABLE_NAME"
+	inStockRetentionEnv    = "RESULTS_IN_STOCK_RETENTION"
+	outOfStockRetentionEnv = "RESULTS_OUT_OF_STOCK_RETENTION"
+	// 1 week
+	defaultRetention = 7 * 24 * time.Hour
+)
+
+// ResultStore records the result of each check of the product in q for auditing.
+type ResultStore interface {
+	SaveResult(ctx context.Context, q schema.ProductQuery, result audit.Result) error
+}
+
+type DynamoDBPutItemAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+// DynamoResultStore writes results to the results table, in the layout described in the audit package.  The TTL of
+// each result is from Retention, with any durations set in the product's retention in place of the defaults.  The
+// latest item is only replaced by a result checked at the same time or later, so overlapping checks of a product
+// leave the newest one as the latest.
+type DynamoResultStore struct {
+	API       DynamoDBPutItemAPI
+	Table     string
+	Retention audit.RetentionPolicy
+	Logger    *log.Logger
+}
+
+func (s DynamoResultStore) SaveResult(ctx context.Context, q schema.ProductQuery, result audit.Result) error {
+	policy, err := s.Retention.ForProduct(q)
+	if err != nil {
+		return err
+	}
+	result.TTL = policy.TTL(result)
+	items := result.Items()
+	if _, err := s.API.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(s.Table), Item: items[0]}); err != nil {
+		return err
+	}
+	_, err = s.API.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(s.Table),
+		Item:                      items[1],
+		ConditionExpression:       aws.String(audit.LatestCondition),
+		ExpressionAttributeValues: audit.Item{":checked_at": audit.Int(result.CheckedAt)},
+	})
+	var newer *types.ConditionalCheckFailedException
+	if errors.As(err, &newer) {
+		s.Logger.Printf("a newer result of %s is already the latest\n", q.TCIN)
+		return nil
+	}
+	return err
+}
+
+// configureResultStore writes results to table, logging to l, or returns nil if it is empty.
+func configureResultStore(ctx context.Context, l *log.Logger, table string, retention audit.RetentionPolicy) (ResultStore, error) {
+	if table == "" {
+		return nil, nil
+	}
+	client, err := awsclient.DynamoDB(ctx, l)
+	if err != nil {
+		return nil, err
+	}
+	return DynamoResultStore{API: client, Table: table, Retention: retention, Logger: l}, nil
+}
+
+// configureRetention reads how long results are kept by default, for each status, as Go durations, e.g. "2160h".
+func configureRetention() (audit.RetentionPolicy, error) {
+	inStock, err := audit.ParseRetention(os.Getenv(inStockRetentionEnv), defaultRetention)
+	if err != nil {
+		return audit.RetentionPolicy{}, fmt.Errorf("%s: %w", inStockRetentionEnv, err)
+	}
+	outOfStock, err := audit.ParseRetention(os.Getenv(outOfStockRetentionEnv), defaultRetention)
+	if err != nil {
+		return audit.RetentionPolicy{}, fmt.Errorf("%s: %w", outOfStockRetentionEnv, err)
+	}
+	return audit.RetentionPolicy{InStock: inStock, OutOfStock: outOfStock}, nil
+}
@@ -0,0 +1,228 @@
+package checker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/audit"
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type mockDynamoDBPutItemAPI func(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+
+func (m mockDynamoDBPutItemAPI) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+// recordingResultStore keeps the results it is given, or fails with err.
+type recordingResultStore struct {
+	results []audit.Result
+	err     error
+}
+
+func (s *recordingResultStore) SaveResult(ctx context.Context, q schema.ProductQuery, result audit.Result) error {
+	s.results = append(s.results, result)
+	return s.err
+}
+
+func TestDynamoResultStore_SaveResult(t *testing.T) {
+	checkedAt := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	outOfStock := audit.Result{TCIN: "123", Name: "formula", CheckedAt: checkedAt.Unix(), Status: schema.StatusOutOfStock}
+	inStock := outOfStock
+	inStock.Status = schema.StatusInStock
+	policy := audit.RetentionPolicy{InStock: 90 * 24 * time.Hour, OutOfStock: 3 * 24 * time.Hour}
+	cases := map[string]struct {
+		query       schema.ProductQuery
+		result      audit.Result
+		err         error
+		latestErr   error
+		expectedErr bool
+		expectedPut int
+		expectedTTL int64
+	}{
+		"Result and latest items are written": {
+			result:      outOfStock,
+			expectedPut: 2,
+			expectedTTL: checkedAt.Add(3 * 24 * time.Hour).Unix(),
+		},
+		"In stock results are kept longer": {
+			result:      inStock,
+			expectedPut: 2,
+			expectedTTL: checkedAt.Add(90 * 24 * time.Hour).Unix(),
+		},
+		"Product retention replaces the policy": {
+			query:       schema.ProductQuery{TCIN: "123", Retention: &schema.Retention{OutOfStock: "1h"}},
+			result:      outOfStock,
+			expectedPut: 2,
+			expectedTTL: checkedAt.Add(time.Hour).Unix(),
+		},
+		"Product retention keeps the policy it does not set": {
+			query:       schema.ProductQuery{TCIN: "123", Retention: &schema.Retention{OutOfStock: "1h"}},
+			result:      inStock,
+			expectedPut: 2,
+			expectedTTL: checkedAt.Add(90 * 24 * time.Hour).Unix(),
+		},
+		"Invalid product retention returns error": {
+			query:       schema.ProductQuery{TCIN: "123", Retention: &schema.Retention{InStock: "90 days"}},
+			result:      inStock,
+			expectedErr: true,
+		},
+		"A newer latest item is kept": {
+			result:      outOfStock,
+			latestErr:   &types.ConditionalCheckFailedException{},
+			expectedPut: 2,
+			expectedTTL: checkedAt.Add(3 * 24 * time.Hour).Unix(),
+		},
+		"Failing to write the latest item returns error": {
+			result:      outOfStock,
+			latestErr:   errors.New("throttled"),
+			expectedErr: true,
+			expectedPut: 2,
+			expectedTTL: checkedAt.Add(3 * 24 * time.Hour).Unix(),
+		},
+		"API error returns error": {
+			result:      outOfStock,
+			err:         errors.New("throttled"),
+			expectedErr: true,
+			expectedPut: 1,
+			expectedTTL: checkedAt.Add(3 * 24 * time.Hour).Unix(),
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			var keys []string
+			api := mockDynamoDBPutItemAPI(func(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+				if aws.ToString(params.TableName) != "results" {
+					t.Errorf("unexpected table %s", aws.ToString(params.TableName))
+				}
+				item := audit.Item(params.Item)
+				if ttl := item.Int(audit.TTLAttribute); ttl != tt.expectedTTL {
+					t.Errorf("wanted TTL %d, got %d", tt.expectedTTL, ttl)
+				}
+				keys = append(keys, item.String(audit.PartitionKey)+" "+item.String(audit.SortKey))
+				if item.String(audit.PartitionKey) != audit.LatestKey {
+					if params.ConditionExpression != nil {
+						t.Errorf("expected the result item to be written unconditionally, got %s", *params.ConditionExpression)
+					}
+					return &dynamodb.PutItemOutput{}, tt.err
+				}
+				if aws.ToString(params.ConditionExpression) != audit.LatestCondition || audit.Item(params.ExpressionAttributeValues).Int(":checked_at") != tt.result.CheckedAt {
+					t.Errorf("expected the latest item to be conditional on its check time, got %v", params)
+				}
+				return &dynamodb.PutItemOutput{}, tt.latestErr
+			})
+			store := DynamoResultStore{API: api, Table: "results", Retention: policy, Logger: log.Default()}
+
+			err := store.SaveResult(context.Background(), tt.query, tt.result)
+
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("wanted error %t, got %v", tt.expectedErr, err)
+			}
+			if len(keys) != tt.expectedPut {
+				t.Errorf("expected %d items, got %v", tt.expectedPut, keys)
+			}
+			if len(keys) == 2 && (keys[0] != "TCIN#123 RESULT#2022-06-01T12:00:00Z" || keys[1] != "LATEST TCIN#123") {
+				t.Errorf("unexpected keys: %v", keys)
+			}
+		})
+	}
+}
+
+func TestConfigureRetention(t *testing.T) {
+	cases := map[string]struct {
+		env         map[string]string
+		expected    audit.RetentionPolicy
+		expectedErr bool
+	}{
+		"Defaults to a week": {
+			expected: audit.RetentionPolicy{InStock: defaultRetention, OutOfStock: defaultRetention},
+		},
+		"Retention for each status": {
+			env:      map[string]string{inStockRetentionEnv: "2160h", outOfStockRetentionEnv: "72h"},
+			expected: audit.RetentionPolicy{InStock: 90 * 24 * time.Hour, OutOfStock: 3 * 24 * time.Hour},
+		},
+		"Invalid retention is an error": {
+			env:         map[string]string{outOfStockRetentionEnv: "3 days"},
+			expectedErr: true,
+		},
+		"Retention must be positive": {
+			env:         map[string]string{inStockRetentionEnv: "-1h"},
+			expectedErr: true,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(inStockRetentionEnv, "")
+			t.Setenv(outOfStockRetentionEnv, "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			actual, err := configureRetention()
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("wanted error %t, got %v", tt.expectedErr, err)
+			}
+			if actual != tt.expected {
+				t.Errorf("wanted %+v, got %+v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestHandler_SaveResult(t *testing.T) {
+	query := schema.ProductQuery{Name: "mock-product", TCIN: "123456", DesiredQuantity: 1}
+	cases := map[string]struct {
+		err           error
+		priceResponse string
+		expectedPrice float64
+	}{
+		"Result is saved with its price": {
+			priceResponse: `{"data":{"product":{"tcin":"123456","price":{"current_retail":18.99,"formatted_current_price":"$18.99"}}}}`,
+			expectedPrice: 18.99,
+		},
+		"Failing to save is not an error":  {err: errors.New("throttled"), priceResponse: `{}`},
+		"Failing to price is not an error": {priceResponse: `not json`},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == pdpBasePath {
+					w.Write([]byte(tt.priceResponse))
+					return
+				}
+				b, _ := json.Marshal(TargetAPIResult{})
+				w.Write(b)
+			}))
+			defer mockServer.Close()
+			store := &recordingResultStore{err: tt.err}
+			h := testHandler(mockServer.URL)
+			h.results = store
+
+			actual, err := h.Handle(context.Background(), query)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(store.results) != 1 {
+				t.Fatalf("expected one saved result, got %d", len(store.results))
+			}
+			if saved := store.results[0]; saved.TCIN != "123456" || saved.Status != schema.StatusOutOfStock || saved.TotalStores != actual.Pickup.TotalStores {
+				t.Errorf("unexpected result: %+v", saved)
+			}
+			if saved := store.results[0]; saved.Price != tt.expectedPrice {
+				t.Errorf("wanted price %v, got %v", tt.expectedPrice, saved.Price)
+			}
+		})
+	}
+}
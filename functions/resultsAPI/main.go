@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/audit"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+const (
+	latestRoute  = "GET /results/latest"
+	productRoute = "GET /products/{tcin}/results"
+	stockRoute   = "GET /stores/in-stock"
+	// the default time range of the product results and in-stock stores
+	defaultWindow = 24 * time.Hour
+	// the longest time range of the in-stock stores.  It is queried one UTC day at a time, so this bounds the queries
+	// of a request to 8, however long the results are kept.
+	maxWindow = 7 * 24 * time.Hour
+)
+
+var (
+	reader ResultsReader
+	logger *log.Logger
+	now    = time.Now
+)
+
+// errorResponse is the body of a response that is not OK.
+type errorResponse struct {
+	Message string `json:"message"`
+}
+
+// StoreStock is a store that had products in stock, and the products it had.
+type StoreStock struct {
+	StoreID      string         `json:"store_id"`
+	LocationName string         `json:"location_name"`
+	Distance     float64        `json:"distance"`
+	Products     []StoreProduct `json:"products"`
+}
+
+// StoreProduct is a product a store had in stock: when it was last seen, and the quantity then.
+type StoreProduct struct {
+	TCIN        string `json:"tcin"`
+	Name        string `json:"name"`
+	LastInStock int64  `json:"last_in_stock"`
+	Quantity    int    `json:"quantity"`
+}
+
+func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	logger.Printf("request: %s %+v\n", req.RouteKey, req.QueryStringParameters)
+	var body interface{}
+	var err error
+	switch req.RouteKey {
+	case latestRoute:
+		body, err = reader.Latest(ctx)
+	case productRoute:
+		body, err = productResults(ctx, req)
+	case stockRoute:
+		body, err = storesInStock(ctx, req)
+	default:
+		return respond(http.StatusNotFound, errorResponse{Message: fmt.Sprintf("no route %s", req.RouteKey)})
+	}
+	var badRequest badRequestError
+	if errors.As(err, &badRequest) {
+		return respond(http.StatusBadRequest, errorResponse{Message: err.Error()})
+	}
+	if err != nil {
+		logger.Printf("unable to read results: %s\n", err)
+		return respond(http.StatusInternalServerError, errorResponse{Message: "unable to read results"})
+	}
+	return respond(http.StatusOK, body)
+}
+
+func main() {
+	logger = log.Default()
+	logger.SetPrefix("results_api ")
+	logger.SetFlags(log.Lshortfile | log.Lmsgprefix)
+	r, err := configureReader(context.Background())
+	reader = r
+	if err != nil {
+		panic(err)
+	}
+	lambda.Start(handler)
+}
+
+// badRequestError is an error in the parameters of a request.
+type badRequestError string
+
+func (e badRequestError) Error() string {
+	return string(e)
+}
+
+// productResults are the results of the product in the path, between the times in the "from" and "to" parameters.
+func productResults(ctx context.Context, req events.APIGatewayV2HTTPRequest) ([]audit.Result, error) {
+	to, err := timeParam(req, "to", now())
+	if err != nil {
+		return nil, err
+	}
+	from, err := timeParam(req, "from", to.Add(-defaultWindow))
+	if err != nil {
+		return nil, err
+	}
+	if from.After(to) {
+		return nil, badRequestError("from must not be after to")
+	}
+	return reader.Results(ctx, req.PathParameters["tcin"], from, to)
+}
+
+// storesInStock are the stores that had any product in stock in the number of hours in the "hours" parameter.
+func storesInStock(ctx context.Context, req events.APIGatewayV2HTTPRequest) ([]StoreStock, error) {
+	window := defaultWindow
+	if raw, ok := req.QueryStringParameters["hours"]; ok {
+		hours, err := strconv.Atoi(raw)
+		if err != nil || hours <= 0 || time.Duration(hours)*time.Hour > maxWindow {
+			return nil, badRequestError(fmt.Sprintf("hours must be a whole number from 1 to %.0f", maxWindow.Hours()))
+		}
+		window = time.Duration(hours) * time.Hour
+	}
+	to := now()
+	results, err := reader.InStock(ctx, to.Add(-window), to)
+	if err != nil {
+		return nil, err
+	}
+	return storeStock(results), nil
+}
+
+// timeParam reads an RFC 3339 time from the query parameter, or returns def if it is not set.
+func timeParam(req events.APIGatewayV2HTTPRequest, name string, def time.Time) (time.Time, error) {
+	raw, ok := req.QueryStringParameters[name]
+	if !ok {
+		return def, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, badRequestError(fmt.Sprintf("%s must be an RFC 3339 time, e.g. 2022-06-01T12:00:00Z", name))
+	}
+	return t, nil
+}
+
+// storeStock groups in-stock results, oldest first, by store, nearest first.  Each product has the quantity of the
+// most recent result it was in stock at the store.
+func storeStock(results []audit.Result) []StoreStock {
+	byStore := map[string]*StoreStock{}
+	for _, r := range results {
+		for _, s := range r.Stores {
+			store, ok := byStore[s.StoreID]
+			if !ok {
+				store = &StoreStock{StoreID: s.StoreID, LocationName: s.LocationName, Distance: s.Distance}
+				byStore[s.StoreID] = store
+			}
+			product := StoreProduct{TCIN: r.TCIN, Name: r.Name, LastInStock: r.CheckedAt, Quantity: s.Quantity}
+			found := false
+			for i, p := range store.Products {
+				if p.TCIN == r.TCIN {
+					store.Products[i] = product
+					found = true
+				}
+			}
+			if !found {
+				store.Products = append(store.Products, product)
+			}
+		}
+	}
+	stores := []StoreStock{}
+	for _, s := range byStore {
+		sort.Slice(s.Products, func(i, j int) bool {
+			if s.Products[i].Name != s.Products[j].Name {
+				return s.Products[i].Name < s.Products[j].Name
+			}
+			return s.Products[i].TCIN < s.Products[j].TCIN
+		})
+		stores = append(stores, *s)
+	}
+	sort.Slice(stores, func(i, j int) bool {
+		if stores[i].Distance != stores[j].Distance {
+			return stores[i].Distance < stores[j].Distance
+		}
+		return stores[i].StoreID < stores[j].StoreID
+	})
+	return stores
+}
+
+func respond(status int, body interface{}) (events.APIGatewayV2HTTPResponse, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(b),
+	}, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/audit"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// failingReader fails every read with err.
+type failingReader struct {
+	err error
+}
+
+func (f failingReader) Latest(ctx context.Context) ([]audit.Result, error) {
+	return nil, f.err
+}
+
+func (f failingReader) Results(ctx context.Context, tcin string, from, to time.Time) ([]audit.Result, error) {
+	return nil, f.err
+}
+
+func (f failingReader) InStock(ctx context.Context, from, to time.Time) ([]audit.Result, error) {
+	return nil, f.err
+}
+
+func TestHandler(t *testing.T) {
+	logger = log.Default()
+	current := time.Date(2022, 6, 2, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	t.Cleanup(func() { now = time.Now })
+	denver := audit.StoreQuantity{StoreID: "1234", LocationName: "Denver", Quantity: 2, Distance: 1.5}
+	aurora := audit.StoreQuantity{StoreID: "5678", LocationName: "Aurora", Quantity: 1, Distance: 7}
+	lastWeek := testResult("123", "formula", current.Add(-6*24*time.Hour), aurora)
+	yesterday := testResult("123", "formula", current.Add(-20*time.Hour), denver)
+	recent := testResult("123", "formula", current.Add(-time.Hour))
+	diapers := testResult("456", "diapers", current.Add(-2*time.Hour), aurora, audit.StoreQuantity{StoreID: "1234", LocationName: "Denver", Quantity: 5, Distance: 1.5})
+	results := MemoryResultsReader{lastWeek, yesterday, recent, diapers}
+	cases := map[string]struct {
+		req            events.APIGatewayV2HTTPRequest
+		reader         ResultsReader
+		expectedStatus int
+		expected       interface{}
+	}{
+		"Latest result of each product": {
+			req:            events.APIGatewayV2HTTPRequest{RouteKey: latestRoute},
+			expectedStatus: http.StatusOK,
+			expected:       []audit.Result{diapers, recent},
+		},
+		"Product results from the last day": {
+			req: events.APIGatewayV2HTTPRequest{
+				RouteKey:       productRoute,
+				PathParameters: map[string]string{"tcin": "123"},
+			},
+			expectedStatus: http.StatusOK,
+			expected:       []audit.Result{yesterday, recent},
+		},
+		"Product results in a time range": {
+			req: events.APIGatewayV2HTTPRequest{
+				RouteKey:              productRoute,
+				PathParameters:        map[string]string{"tcin": "123"},
+				QueryStringParameters: map[string]string{"from": "2022-05-27T00:00:00Z", "to": "2022-06-02T00:00:00Z"},
+			},
+			expectedStatus: http.StatusOK,
+			expected:       []audit.Result{lastWeek, yesterday},
+		},
+		"Product results need RFC 3339 times": {
+			req: events.APIGatewayV2HTTPRequest{
+				RouteKey:              productRoute,
+				PathParameters:        map[string]string{"tcin": "123"},
+				QueryStringParameters: map[string]string{"from": "yesterday"},
+			},
+			expectedStatus: http.StatusBadRequest,
+			expected:       errorResponse{Message: "from must be an RFC 3339 time, e.g. 2022-06-01T12:00:00Z"},
+		},
+		"Product results need from before to": {
+			req: events.APIGatewayV2HTTPRequest{
+				RouteKey:              productRoute,
+				PathParameters:        map[string]string{"tcin": "123"},
+				QueryStringParameters: map[string]string{"from": "2022-06-02T00:00:00Z", "to": "2022-06-01T00:00:00Z"},
+			},
+			expectedStatus: http.StatusBadRequest,
+			expected:       errorResponse{Message: "from must not be after to"},
+		},
+		"Stores with stock in the last day": {
+			req:            events.APIGatewayV2HTTPRequest{RouteKey: stockRoute},
+			expectedStatus: http.StatusOK,
+			expected: []StoreStock{
+				{StoreID: "1234", LocationName: "Denver", Distance: 1.5, Products: []StoreProduct{
+					{TCIN: "456", Name: "diapers", LastInStock: diapers.CheckedAt, Quantity: 5},
+					{TCIN: "123", Name: "formula", LastInStock: yesterday.CheckedAt, Quantity: 2},
+				}},
+				{StoreID: "5678", LocationName: "Aurora", Distance: 7, Products: []StoreProduct{
+					{TCIN: "456", Name: "diapers", LastInStock: diapers.CheckedAt, Quantity: 1},
+				}},
+			},
+		},
+		"Stores with stock in the last hours": {
+			req: events.APIGatewayV2HTTPRequest{
+				RouteKey:              stockRoute,
+				QueryStringParameters: map[string]string{"hours": "1"},
+			},
+			expectedStatus: http.StatusOK,
+			expected:       []StoreStock{},
+		},
+		"Hours must be at most a week": {
+			req: events.APIGatewayV2HTTPRequest{
+				RouteKey:              stockRoute,
+				QueryStringParameters: map[string]string{"hours": "169"},
+			},
+			expectedStatus: http.StatusBadRequest,
+			expected:       errorResponse{Message: "hours must be a whole number from 1 to 168"},
+		},
+		"Unknown route is not found": {
+			req:            events.APIGatewayV2HTTPRequest{RouteKey: "GET /stats"},
+			expectedStatus: http.StatusNotFound,
+			expected:       errorResponse{Message: "no route GET /stats"},
+		},
+		"Failing to read is an internal error": {
+			req:            events.APIGatewayV2HTTPRequest{RouteKey: latestRoute},
+			reader:         failingReader{err: errors.New("throttled")},
+			expectedStatus: http.StatusInternalServerError,
+			expected:       errorResponse{Message: "unable to read results"},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			reader = results
+			if tt.reader != nil {
+				reader = tt.reader
+			}
+
+			actual, err := handler(context.Background(), tt.req)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if actual.StatusCode != tt.expectedStatus {
+				t.Errorf("wanted status %d, got %d", tt.expectedStatus, actual.StatusCode)
+			}
+			if actual.Headers["Content-Type"] != "application/json" {
+				t.Errorf("unexpected headers %v", actual.Headers)
+			}
+			expected, _ := json.Marshal(tt.expected)
+			if string(expected) != actual.Body {
+				t.Errorf("wanted %s\ngot %s", expected, actual.Body)
+			}
+		})
+	}
+}
+
+func TestStoreStock(t *testing.T) {
+	start := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	store := audit.StoreQuantity{StoreID: "1234", LocationName: "Denver", Quantity: 2}
+	later := store
+	later.Quantity = 4
+	results := []audit.Result{
+		testResult("123", "formula", start, store),
+		testResult("123", "formula", start.Add(time.Hour), later),
+	}
+	expected := []StoreStock{{StoreID: "1234", LocationName: "Denver", Products: []StoreProduct{
+		{TCIN: "123", Name: "formula", LastInStock: start.Add(time.Hour).Unix(), Quantity: 4},
+	}}}
+
+	if actual := storeStock(results); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("wanted %+v, got %+v", expected, actual)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/audit"
+	"github.com/akijowski/target-tracker/internal/awsclient"
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+const resultsTableEnv = "RESULTS_TABLE_NAME"
+
+// ResultsReader reads the audit records the product checker saves.
+type ResultsReader interface {
+	// Latest returns the most recent result of each product, in order of name.
+	Latest(ctx context.Context) ([]audit.Result, error)
+	// Results returns the results of the product checked between from and to, inclusive, oldest first.
+	Results(ctx context.Context, tcin string, from, to time.Time) ([]audit.Result, error)
+	// InStock returns the results of every product that was in stock when checked between from and to, inclusive,
+	// oldest first.
+	InStock(ctx context.Context, from, to time.Time) ([]audit.Result, error)
+}
+
+type DynamoDBQueryAPI interface {
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+// DynamoResultsReader queries the results table, in the layout described in the audit package.
+type DynamoResultsReader struct {
+	API   DynamoDBQueryAPI
+	Table string
+}
+
+func (d DynamoResultsReader) Latest(ctx context.Context) ([]audit.Result, error) {
+	results, err := d.query(ctx, &dynamodb.QueryInput{
+		KeyConditionExpression:    aws.String("#pk = :pk"),
+		ExpressionAttributeNames:  map[string]string{"#pk": audit.PartitionKey},
+		ExpressionAttributeValues: audit.Item{":pk": audit.String(audit.LatestKey)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortByName(results)
+	return results, nil
+}
+
+func (d DynamoResultsReader) Results(ctx context.Context, tcin string, from, to time.Time) ([]audit.Result, error) {
+	return d.query(ctx, &dynamodb.QueryInput{
+		KeyConditionExpression:   aws.String("#pk = :pk AND #sk BETWEEN :from AND :to"),
+		ExpressionAttributeNames: map[string]string{"#pk": audit.PartitionKey, "#sk": audit.SortKey},
+		ExpressionAttributeValues: audit.Item{
+			":pk":   audit.String(audit.ProductKey(tcin)),
+			":from": audit.String(audit.ResultSortKey(from)),
+			":to":   audit.String(audit.ResultSortKey(to)),
+		},
+	})
+}
+
+// InStock queries the in-stock index once for each UTC day in the range.
+func (d DynamoResultsReader) InStock(ctx context.Context, from, to time.Time) ([]audit.Result, error) {
+	results := []audit.Result{}
+	for day := truncateDay(from); !day.After(to); day = day.AddDate(0, 0, 1) {
+		page, err := d.query(ctx, &dynamodb.QueryInput{
+			IndexName:                aws.String(audit.InStockIndex),
+			KeyConditionExpression:   aws.String("#pk = :pk AND #sk BETWEEN :from AND :to"),
+			ExpressionAttributeNames: map[string]string{"#pk": audit.InStockKey, "#sk": audit.InStockSort},
+			ExpressionAttributeValues: audit.Item{
+				":pk":   audit.String(audit.InStockDateKey(day)),
+				":from": audit.String(audit.InStockSortKey(from)),
+				// sort keys at to have the TCIN after the time, so the bound is the next second
+				":to": audit.String(audit.InStockSortKey(to.Add(time.Second))),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, page...)
+	}
+	return results, nil
+}
+
+// query reads every page of the query from the table.
+func (d DynamoResultsReader) query(ctx context.Context, in *dynamodb.QueryInput) ([]audit.Result, error) {
+	in.TableName = aws.String(d.Table)
+	results := []audit.Result{}
+	pages := dynamodb.NewQueryPaginator(d.API, in)
+	for pages.HasMorePages() {
+		out, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range out.Items {
+			results = append(results, audit.ResultFromItem(item))
+		}
+	}
+	return results, nil
+}
+
+// MemoryResultsReader is a ResultsReader over results held in memory, in any order.  It is meant for tests.
+type MemoryResultsReader []audit.Result
+
+func (m MemoryResultsReader) Latest(ctx context.Context) ([]audit.Result, error) {
+	latest := map[string]audit.Result{}
+	for _, r := range m {
+		if l, ok := latest[r.TCIN]; !ok || r.CheckedAt > l.CheckedAt {
+			latest[r.TCIN] = r
+		}
+	}
+	results := []audit.Result{}
+	for _, r := range latest {
+		results = append(results, r)
+	}
+	sortByName(results)
+	return results, nil
+}
+
+func (m MemoryResultsReader) Results(ctx context.Context, tcin string, from, to time.Time) ([]audit.Result, error) {
+	return m.filter(func(r audit.Result) bool {
+		return r.TCIN == tcin && r.CheckedAt >= from.Unix() && r.CheckedAt <= to.Unix()
+	}), nil
+}
+
+func (m MemoryResultsReader) InStock(ctx context.Context, from, to time.Time) ([]audit.Result, error) {
+	return m.filter(func(r audit.Result) bool {
+		return r.Status == schema.StatusInStock && r.CheckedAt >= from.Unix() && r.CheckedAt <= to.Unix()
+	}), nil
+}
+
+func (m MemoryResultsReader) filter(keep func(audit.Result) bool) []audit.Result {
+	results := []audit.Result{}
+	for _, r := range m {
+		if keep(r) {
+			results = append(results, r)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].CheckedAt < results[j].CheckedAt })
+	return results
+}
+
+// sortByName puts results in order of product name, then TCIN.
+func sortByName(results []audit.Result) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Name != results[j].Name {
+			return results[i].Name < results[j].Name
+		}
+		return results[i].TCIN < results[j].TCIN
+	})
+}
+
+func truncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// configureReader reads the results from the table in RESULTS_TABLE_NAME.
+func configureReader(ctx context.Context) (ResultsReader, error) {
+	table := os.Getenv(resultsTableEnv)
+	logger.Printf("found results table: %s\n", table)
+	client, err := awsclient.DynamoDB(ctx, logger)
+	if err != nil {
+		return nil, err
+	}
+	return DynamoResultsReader{API: client, Table: table}, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/akijowski/target-tracker/internal/audit"
+	"github.com/akijowski/target-tracker/internal/schema"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+type mockDynamoDBQueryAPI func(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+
+func (m mockDynamoDBQueryAPI) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+func testResult(tcin, name string, checkedAt time.Time, stores ...audit.StoreQuantity) audit.Result {
+	r := audit.Result{TCIN: tcin, Name: name, CheckedAt: checkedAt.Unix(), Status: schema.StatusOutOfStock, Stores: []audit.StoreQuantity{}}
+	if len(stores) > 0 {
+		r.Status = schema.StatusInStock
+		r.TotalStores = len(stores)
+		r.Stores = stores
+	}
+	return r
+}
+
+func TestDynamoResultsReader(t *testing.T) {
+	from := time.Date(2022, 6, 1, 22, 0, 0, 0, time.UTC)
+	to := time.Date(2022, 6, 2, 2, 0, 0, 0, time.UTC)
+	first := testResult("123", "formula", from.Add(time.Hour), audit.StoreQuantity{StoreID: "1234", Quantity: 2})
+	second := testResult("456", "diapers", to.Add(-time.Hour), audit.StoreQuantity{StoreID: "1234", Quantity: 1})
+	cases := map[string]struct {
+		read             func(r DynamoResultsReader) ([]audit.Result, error)
+		pages            [][]audit.Result
+		expectedIndex    string
+		expectedKeys     []string
+		expectedSortKeys [2]string
+		expected         []audit.Result
+	}{
+		"Latest results are in order of name": {
+			read:         func(r DynamoResultsReader) ([]audit.Result, error) { return r.Latest(context.Background()) },
+			pages:        [][]audit.Result{{first}, {second}},
+			expectedKeys: []string{"LATEST", "LATEST"},
+			expected:     []audit.Result{second, first},
+		},
+		"Product results are a range of sort keys": {
+			read: func(r DynamoResultsReader) ([]audit.Result, error) {
+				return r.Results(context.Background(), "123", from, to)
+			},
+			pages:            [][]audit.Result{{first}},
+			expectedKeys:     []string{"TCIN#123"},
+			expectedSortKeys: [2]string{"RESULT#2022-06-01T22:00:00Z", "RESULT#2022-06-02T02:00:00Z"},
+			expected:         []audit.Result{first},
+		},
+		"In stock results are queried for each day": {
+			read: func(r DynamoResultsReader) ([]audit.Result, error) {
+				return r.InStock(context.Background(), from, to)
+			},
+			pages:            [][]audit.Result{{first}, {second}},
+			expectedIndex:    audit.InStockIndex,
+			expectedKeys:     []string{"INSTOCK#2022-06-01", "INSTOCK#2022-06-02"},
+			expectedSortKeys: [2]string{"2022-06-01T22:00:00Z", "2022-06-02T02:00:01Z"},
+			expected:         []audit.Result{first, second},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			var keys []string
+			calls := 0
+			api := mockDynamoDBQueryAPI(func(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+				if aws.ToString(params.TableName) != "results" || aws.ToString(params.IndexName) != tt.expectedIndex {
+					t.Errorf("unexpected table %s and index %s", aws.ToString(params.TableName), aws.ToString(params.IndexName))
+				}
+				values := audit.Item(params.ExpressionAttributeValues)
+				if tt.expectedSortKeys[0] != "" {
+					actual := [2]string{values.String(":from"), values.String(":to")}
+					if actual != tt.expectedSortKeys {
+						t.Errorf("wanted sort keys %v, got %v", tt.expectedSortKeys, actual)
+					}
+				}
+				keys = append(keys, values.String(":pk"))
+				out := &dynamodb.QueryOutput{}
+				for _, r := range tt.pages[calls] {
+					out.Items = append(out.Items, r.Items()[0])
+				}
+				calls++
+				// the latest items are one key, so the second page follows from the first
+				if tt.expectedIndex == "" && calls < len(tt.pages) {
+					out.LastEvaluatedKey = out.Items[len(out.Items)-1]
+				}
+				return out, nil
+			})
+
+			actual, err := tt.read(DynamoResultsReader{API: api, Table: "results"})
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(tt.expectedKeys, keys) {
+				t.Errorf("wanted keys %v, got %v", tt.expectedKeys, keys)
+			}
+			if !reflect.DeepEqual(tt.expected, actual) {
+				t.Errorf("wanted %+v, got %+v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDynamoResultsReader_Error(t *testing.T) {
+	expectedErr := errors.New("throttled")
+	api := mockDynamoDBQueryAPI(func(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+		return nil, expectedErr
+	})
+
+	_, err := DynamoResultsReader{API: api, Table: "results"}.Latest(context.Background())
+
+	if !errors.Is(err, expectedErr) {
+		t.Errorf("wanted error %v, got %v", expectedErr, err)
+	}
+}
+
+func TestMemoryResultsReader(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	store := audit.StoreQuantity{StoreID: "1234", Quantity: 2}
+	older := testResult("123", "formula", start, store)
+	newer := testResult("123", "formula", start.Add(time.Hour))
+	other := testResult("456", "diapers", start.Add(30*time.Minute), store)
+	reader := MemoryResultsReader{newer, other, older}
+
+	latest, _ := reader.Latest(ctx)
+	if expected := []audit.Result{other, newer}; !reflect.DeepEqual(expected, latest) {
+		t.Errorf("wanted latest %+v, got %+v", expected, latest)
+	}
+	results, _ := reader.Results(ctx, "123", start, start.Add(time.Hour))
+	if expected := []audit.Result{older, newer}; !reflect.DeepEqual(expected, results) {
+		t.Errorf("wanted results %+v, got %+v", expected, results)
+	}
+	inStock, _ := reader.InStock(ctx, start.Add(time.Minute), start.Add(time.Hour))
+	if expected := []audit.Result{other}; !reflect.DeepEqual(expected, inStock) {
+		t.Errorf("wanted in stock %+v, got %+v", expected, inStock)
+	}
+}